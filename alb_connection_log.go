@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AlbConnectionLogRecord is ALB's connection log record, which is written for each connection separately from access log.
+// see: https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-connection-logs.html
+type AlbConnectionLogRecord struct {
+	Time         time.Time
+	ClientIp     string
+	ClientPort   string
+	ListenerPort string
+	TlsProtocol  string
+	TlsCipher    string
+	// TlsHandshakeLatency is seconds to complete TLS handshake, which is -1 when the handshake didn't complete.
+	TlsHandshakeLatency    float64
+	LeafClientCertSubject  string
+	LeafClientCertValidity string
+	LeafClientCertSerial   string
+	TlsVerifyStatus        string
+	ConnTraceId            string
+}
+
+// Indexes of fields of ALB connection log record.
+const (
+	albConnectionLogFieldTime = iota
+	albConnectionLogFieldClientIp
+	albConnectionLogFieldClientPort
+	albConnectionLogFieldListenerPort
+	albConnectionLogFieldTlsProtocol
+	albConnectionLogFieldTlsCipher
+	albConnectionLogFieldTlsHandshakeLatency
+	albConnectionLogFieldLeafClientCertSubject
+	albConnectionLogFieldLeafClientCertValidity
+	albConnectionLogFieldLeafClientCertSerial
+	albConnectionLogFieldTlsVerifyStatus
+	albConnectionLogFieldConnTraceId
+
+	albConnectionLogFieldCount
+)
+
+// albConnectionLogRequiredFieldCount is the number of fields which every record has. conn_trace_id was appended later.
+const albConnectionLogRequiredFieldCount = albConnectionLogFieldConnTraceId
+
+// albConnectionLogQuotedFields is the set of fields enclosed in double quotes, which may include space.
+var albConnectionLogQuotedFields = [albConnectionLogFieldCount]bool{
+	albConnectionLogFieldLeafClientCertSubject: true,
+}
+
+// albConnectionLogFields is fields of ALB connection log record. Values are substrings of the line without double quotes.
+type albConnectionLogFields [albConnectionLogFieldCount]string
+
+func (f *albConnectionLogFields) tokenize(line string) error {
+	return tokenizeLogFields(line, f[:], albConnectionLogQuotedFields[:], albConnectionLogRequiredFieldCount)
+}
+
+// parseAlbConnectionLog parses ALB's connection log record.
+func parseAlbConnectionLog(line string) (*AlbConnectionLogRecord, error) {
+	var f albConnectionLogFields
+	if err := f.tokenize(line); err != nil {
+		return nil, err
+	}
+
+	ts, err := time.Parse(time.RFC3339, f[albConnectionLogFieldTime])
+	if err != nil {
+		return nil, err
+	}
+	tlsHandshakeLatency := -1.0
+	if f[albConnectionLogFieldTlsHandshakeLatency] != "-" {
+		tlsHandshakeLatency, err = strconv.ParseFloat(f[albConnectionLogFieldTlsHandshakeLatency], 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &AlbConnectionLogRecord{
+		Time:                   ts,
+		ClientIp:               f[albConnectionLogFieldClientIp],
+		ClientPort:             f[albConnectionLogFieldClientPort],
+		ListenerPort:           f[albConnectionLogFieldListenerPort],
+		TlsProtocol:            f[albConnectionLogFieldTlsProtocol],
+		TlsCipher:              f[albConnectionLogFieldTlsCipher],
+		TlsHandshakeLatency:    tlsHandshakeLatency,
+		LeafClientCertSubject:  f[albConnectionLogFieldLeafClientCertSubject],
+		LeafClientCertValidity: f[albConnectionLogFieldLeafClientCertValidity],
+		LeafClientCertSerial:   f[albConnectionLogFieldLeafClientCertSerial],
+		TlsVerifyStatus:        f[albConnectionLogFieldTlsVerifyStatus],
+		ConnTraceId:            f[albConnectionLogFieldConnTraceId],
+	}, nil
+}
+
+func (r *AlbConnectionLogRecord) Timestamp() Timestamp {
+	return Timestamp(r.Time.Unix())
+}
+
+func (r *AlbConnectionLogRecord) MetricKey() string {
+	return fmt.Sprintf("%s_%s_%s_%s", r.ListenerPort, r.TlsProtocol, r.TlsCipher, r.TlsVerifyStatus)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// AlbConnectionMetric is metrics of connections of ALB aggregated by listener port, TLS protocol, cipher and verify status.
+type AlbConnectionMetric struct {
+	ConnectionCountMap map[Timestamp]int
+	// TlsHandshakeLatenciesMap is seconds of completed TLS handshakes.
+	TlsHandshakeLatenciesMap map[Timestamp][]float64
+	ListenerPort             string
+	TlsProtocol              string
+	TlsCipher                string
+	TlsVerifyStatus          string
+	// Elb and IpAddress are of the name of log file, because connection log record has neither of them.
+	Elb       string
+	IpAddress string
+}
+
+// ReadAlbConnection reads ALB connection log file and aggregates metrics of connections.
+// Malformed lines are handled in the same way as Read.
+func (p *LogFileReader) ReadAlbConnection(r io.Reader) (*ReadResult, error) {
+	scanner := bufio.NewScanner(r)
+
+	result := &ReadResult{AlbConnectionMetrics: map[string]*AlbConnectionMetric{}}
+	for scanner.Scan() {
+		text := scanner.Text()
+		result.Lines++
+		r, err := parseAlbConnectionLog(text)
+		if err != nil {
+			if err := p.skipMalformedLine(result, text, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		metricKey := r.MetricKey()
+		metric, ok := result.AlbConnectionMetrics[metricKey]
+		if !ok {
+			metric = &AlbConnectionMetric{
+				ConnectionCountMap:       map[Timestamp]int{},
+				TlsHandshakeLatenciesMap: map[Timestamp][]float64{},
+				ListenerPort:             r.ListenerPort,
+				TlsProtocol:              r.TlsProtocol,
+				TlsCipher:                r.TlsCipher,
+				TlsVerifyStatus:          r.TlsVerifyStatus,
+			}
+			result.AlbConnectionMetrics[metricKey] = metric
+		}
+
+		timestamp := r.Timestamp()
+		metric.ConnectionCountMap[timestamp]++
+		// TlsHandshakeLatency is -1 when the handshake didn't complete, which is counted only as a connection.
+		if r.TlsHandshakeLatency >= 0 {
+			metric.TlsHandshakeLatenciesMap[timestamp] = append(metric.TlsHandshakeLatenciesMap[timestamp], r.TlsHandshakeLatency)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.checkMalformedLines(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MergeAlbConnectionMetrics merges metrics of src into dst in the same way as MergeMetrics.
+func MergeAlbConnectionMetrics(dst map[string]*AlbConnectionMetric, src map[string]*AlbConnectionMetric) {
+	for key, metric := range src {
+		d, ok := dst[key]
+		if !ok {
+			dst[key] = metric
+			continue
+		}
+		for timestamp, count := range metric.ConnectionCountMap {
+			d.ConnectionCountMap[timestamp] += count
+		}
+		for timestamp, latencies := range metric.TlsHandshakeLatenciesMap {
+			d.TlsHandshakeLatenciesMap[timestamp] = append(d.TlsHandshakeLatenciesMap[timestamp], latencies...)
+		}
+	}
+}
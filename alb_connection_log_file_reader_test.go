@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogFileReader_ReadAlbConnection(t *testing.T) {
+	reader := NewLogFileReader(&Config{})
+	lines := []string{exampleAlbConnectionEntry, exampleAlbConnectionFailedEntry, exampleAlbConnectionEntry}
+	got, err := reader.ReadAlbConnection(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("ReadAlbConnection() error = %v", err)
+	}
+	if got.Lines != 3 || len(got.AlbConnectionMetrics) != 2 {
+		t.Fatalf("ReadAlbConnection() reads %d lines into %d metrics, want 3 lines into 2 metrics", got.Lines, len(got.AlbConnectionMetrics))
+	}
+
+	timestamp := Timestamp(1696440582)
+	want := &AlbConnectionMetric{
+		ConnectionCountMap:       map[Timestamp]int{timestamp: 2},
+		TlsHandshakeLatenciesMap: map[Timestamp][]float64{timestamp: {0.012, 0.012}},
+		ListenerPort:             "443",
+		TlsProtocol:              "TLSv1.2",
+		TlsCipher:                "ECDHE-RSA-AES128-GCM-SHA256",
+		TlsVerifyStatus:          "Success",
+	}
+	if metric := got.AlbConnectionMetrics["443_TLSv1.2_ECDHE-RSA-AES128-GCM-SHA256_Success"]; !reflect.DeepEqual(metric, want) {
+		t.Errorf("ReadAlbConnection() got = %+v, want %+v", metric, want)
+	}
+	failed := got.AlbConnectionMetrics["443_-_-_Failed:UnableToGetIssuerCert"]
+	if failed == nil || failed.ConnectionCountMap[timestamp] != 1 || len(failed.TlsHandshakeLatenciesMap) != 0 {
+		t.Errorf("ReadAlbConnection() got = %+v for failed handshake", failed)
+	}
+}
+
+func TestLogFileReader_ReadAlbConnection_malformedLine(t *testing.T) {
+	reader := NewLogFileReader(&Config{})
+	if _, err := reader.ReadAlbConnection(strings.NewReader(exampleAlbConnectionEntry + "\ngarbage")); err == nil {
+		t.Error("ReadAlbConnection() error = nil")
+	}
+}
+
+func TestMergeAlbConnectionMetrics(t *testing.T) {
+	dst := map[string]*AlbConnectionMetric{
+		"a": {
+			ConnectionCountMap:       map[Timestamp]int{1: 1},
+			TlsHandshakeLatenciesMap: map[Timestamp][]float64{1: {0.1}},
+		},
+	}
+	src := map[string]*AlbConnectionMetric{
+		"a": {
+			ConnectionCountMap:       map[Timestamp]int{1: 2, 2: 1},
+			TlsHandshakeLatenciesMap: map[Timestamp][]float64{1: {0.2}, 2: {0.3}},
+		},
+		"b": {ConnectionCountMap: map[Timestamp]int{1: 1}},
+	}
+	MergeAlbConnectionMetrics(dst, src)
+
+	if len(dst) != 2 || dst["b"] != src["b"] {
+		t.Fatalf("MergeAlbConnectionMetrics() = %v", dst)
+	}
+	want := &AlbConnectionMetric{
+		ConnectionCountMap:       map[Timestamp]int{1: 3, 2: 1},
+		TlsHandshakeLatenciesMap: map[Timestamp][]float64{1: {0.1, 0.2}, 2: {0.3}},
+	}
+	if !reflect.DeepEqual(dst["a"], want) {
+		t.Errorf("MergeAlbConnectionMetrics() got = %+v, want %+v", dst["a"], want)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// this is ALB's connection log record: https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-connection-logs.html
+var (
+	exampleAlbConnectionEntry       = `2023-10-04T17:29:42.106389Z 192.0.2.1 56730 443 TLSv1.2 ECDHE-RSA-AES128-GCM-SHA256 0.012 "CN=client.example.com,O=Example Corp" NotBefore=2023-09-21T22:43:21Z;NotAfter=2026-09-21T22:43:21Z FEF257E4E1A7C4AD Success TID_1234abcd5678ef90`
+	exampleAlbConnectionFailedEntry = `2023-10-04T17:29:42.306389Z 2001:db8::1 56731 443 - - - "-" - - Failed:UnableToGetIssuerCert TID_1234abcd5678ef91`
+)
+
+func Test_parseAlbConnectionLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *AlbConnectionLogRecord
+		wantErr bool
+	}{
+		{
+			name: "Entry of completed handshake",
+			line: exampleAlbConnectionEntry,
+			want: &AlbConnectionLogRecord{
+				Time:                   time.Date(2023, 10, 4, 17, 29, 42, 106389000, time.UTC),
+				ClientIp:               "192.0.2.1",
+				ClientPort:             "56730",
+				ListenerPort:           "443",
+				TlsProtocol:            "TLSv1.2",
+				TlsCipher:              "ECDHE-RSA-AES128-GCM-SHA256",
+				TlsHandshakeLatency:    0.012,
+				LeafClientCertSubject:  "CN=client.example.com,O=Example Corp",
+				LeafClientCertValidity: "NotBefore=2023-09-21T22:43:21Z;NotAfter=2026-09-21T22:43:21Z",
+				LeafClientCertSerial:   "FEF257E4E1A7C4AD",
+				TlsVerifyStatus:        "Success",
+				ConnTraceId:            "TID_1234abcd5678ef90",
+			},
+		},
+		{
+			name: "Entry of failed handshake",
+			line: exampleAlbConnectionFailedEntry,
+			want: &AlbConnectionLogRecord{
+				Time:                   time.Date(2023, 10, 4, 17, 29, 42, 306389000, time.UTC),
+				ClientIp:               "2001:db8::1",
+				ClientPort:             "56731",
+				ListenerPort:           "443",
+				TlsProtocol:            "-",
+				TlsCipher:              "-",
+				TlsHandshakeLatency:    -1,
+				LeafClientCertSubject:  "-",
+				LeafClientCertValidity: "-",
+				LeafClientCertSerial:   "-",
+				TlsVerifyStatus:        "Failed:UnableToGetIssuerCert",
+				ConnTraceId:            "TID_1234abcd5678ef91",
+			},
+		},
+		{
+			name: "Entry of older format without connection trace ID",
+			line: `2023-10-04T17:29:42.106389Z 192.0.2.1 56730 443 TLSv1.3 TLS_AES_128_GCM_SHA256 0.002 "-" - - -`,
+			want: &AlbConnectionLogRecord{
+				Time:                   time.Date(2023, 10, 4, 17, 29, 42, 106389000, time.UTC),
+				ClientIp:               "192.0.2.1",
+				ClientPort:             "56730",
+				ListenerPort:           "443",
+				TlsProtocol:            "TLSv1.3",
+				TlsCipher:              "TLS_AES_128_GCM_SHA256",
+				TlsHandshakeLatency:    0.002,
+				LeafClientCertSubject:  "-",
+				LeafClientCertValidity: "-",
+				LeafClientCertSerial:   "-",
+				TlsVerifyStatus:        "-",
+			},
+		},
+		{
+			name:    "invalid handshake latency",
+			line:    `2023-10-04T17:29:42.106389Z 192.0.2.1 56730 443 TLSv1.3 TLS_AES_128_GCM_SHA256 fast "-" - - -`,
+			wantErr: true,
+		},
+		{
+			name:    "ALB access log entry",
+			line:    exampleHttpEntry,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAlbConnectionLog(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAlbConnectionLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAlbConnectionLog() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
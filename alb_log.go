@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -40,26 +41,40 @@ type AlbLogRecord struct {
 	Classification         string
 	ClassificationReason   string
 
+	// Fields added to ALB log record later, which are empty when the record is older format.
+	ConnTraceId            string
+	TransformedHost        string
+	TransformedUri         string
+	RequestTransformStatus string
+
 	// Fields from parsing Request.
 	RequestMethod string
 	RequestPath   string
 }
 
 func NewAlbLogRecord(s string, rules []PathTransformingRule) (*AlbLogRecord, error) {
-	r, err := parseAlbLog(s)
+	var fields albLogFields
+	if err := fields.tokenize(s); err != nil {
+		return nil, err
+	}
+	values, err := fields.parseValues(allLogValueFields)
 	if err != nil {
 		return nil, err
 	}
-
-	r.RequestMethod = r.requestMethod()
-	path, err := r.requestPath(rules)
+	path, err := transformRequestPath(fields[albLogFieldRequest], rules)
 	if err != nil {
-		fmt.Printf("failed to get path from request field of alb log record: %s\n", r.Request)
+		fmt.Fprintf(os.Stderr, "failed to get path from request field of alb log record: %s\n", fields[albLogFieldRequest])
 		return nil, err
 	}
-	r.RequestPath = path
+	return newAlbLogRecord(&fields, values, path), nil
+}
 
-	return r, nil
+// newAlbLogRecord converts parsed fields whose request path has been transformed into AlbLogRecord.
+func newAlbLogRecord(fields *albLogFields, values albLogValues, path string) *AlbLogRecord {
+	r := fields.record(values)
+	r.RequestMethod = r.requestMethod()
+	r.RequestPath = path
+	return r
 }
 
 func (r *AlbLogRecord) Timestamp() Timestamp {
@@ -74,8 +89,6 @@ func (r *AlbLogRecord) requestMethod() string {
 	return strings.Split(r.Request, " ")[0]
 }
 
-var requestPathRe = regexp.MustCompile(`(?P<method>.*) (?P<protocol>.*)://(?P<host>[^:]*):?(?P<port>\d*)(?P<path>-|/[^\?]*)\??(?P<query_param>.*) (?P<http_version>.*)`)
-
 type PathTransformingRule struct {
 	Prefix      string
 	Suffix      string
@@ -84,13 +97,17 @@ type PathTransformingRule struct {
 }
 
 func (r *AlbLogRecord) requestPath(rules []PathTransformingRule) (string, error) {
+	return transformRequestPath(r.Request, rules)
+}
+
+// transformRequestPath returns the path of request field transformed by the first matched rule.
+func transformRequestPath(request string, rules []PathTransformingRule) (string, error) {
 	match := false
 	transformed := ""
-	values := requestPathRe.FindStringSubmatch(r.Request)
-	if values == nil {
-		return "", fmt.Errorf("no match regexp: %s", r.Request)
+	uri, ok := requestUriPath(request)
+	if !ok {
+		return "", fmt.Errorf("invalid request: %s", request)
 	}
-	uri := values[requestPathRe.SubexpIndex("path")]
 
 	if uri == "-" {
 		return "", nil
@@ -98,9 +115,9 @@ func (r *AlbLogRecord) requestPath(rules []PathTransformingRule) (string, error)
 
 	for _, rule := range rules {
 		if rule.Regexp != nil {
-			if rule.Regexp.MatchString(uri) {
+			if m := rule.Regexp.FindStringSubmatchIndex(uri); m != nil {
 				match = true
-				transformed = rule.Transformed
+				transformed = expandPathTemplate(rule.Transformed, rule.Regexp, uri, m)
 				break
 			}
 		}
@@ -137,110 +154,343 @@ func (r *AlbLogRecord) requestPath(rules []PathTransformingRule) (string, error)
 	return uri, nil
 }
 
-var parseAlbLogRe = func() *regexp.Regexp {
-	s := []string{
-		`(?P<type>.*?)`,
-		`(?P<time>.*?)`,
-		`(?P<elb>.*?)`,
-		`(?P<clientport>.*?)`,
-		`(?P<targetport>.*?)`,
-		`(?P<request_processing_time>.*?)`,
-		`(?P<target_processing_time>.*?)`,
-		`(?P<response_processing_time>.*?)`,
-		`(?P<elb_status_code>.*?)`,
-		`(?P<target_status_code>.*?)`,
-		`(?P<received_bytes>.*?)`,
-		`(?P<sent_bytes>.*?)`,
-		`"(?P<request>.*?)"`,
-		`"(?P<user_agent>.*?)"`,
-		`(?P<ssl_cipher>.*?)`,
-		`(?P<ssl_protocol>.*?)`,
-		`(?P<target_group_arn>.*?)`,
-		`"(?P<trace_id>.*?)"`,
-		`"(?P<domain_name>.*?)"`,
-		`"(?P<chosen_cert_arn>.*?)"`,
-		`(?P<matched_rule_priority>.*?)`,
-		`(?P<request_creation_time>.*?)`,
-		`"(?P<actions_executed>.*?)"`,
-		`"(?P<redirect_url>.*?)"`,
-		`"(?P<error_reason>.*?)"`,
-		`"(?P<target_port_list>.*?)"`,
-		`"(?P<target_status_code_list>.*?)"`,
-		`"(?P<classification>.*?)"`,
-		`"(?P<classification_reason>.*?)"`,
-	}
-	return regexp.MustCompile(strings.Join(s, `\s`))
-}()
+// requestUriPath returns the path of request field like `GET https://www.example.com:443/path?query HTTP/1.1`.
+// The path is `-` when the request is malformed, e.g. `- https://www.example.com:443- -`.
+func requestUriPath(request string) (string, bool) {
+	_, rest, ok := strings.Cut(request, " ")
+	if !ok {
+		return "", false
+	}
+	i := strings.LastIndexByte(rest, ' ')
+	if i < 0 {
+		return "", false
+	}
+	_, hostAndPath, ok := strings.Cut(rest[:i], "://")
+	if !ok {
+		return "", false
+	}
+	j := strings.IndexByte(hostAndPath, '/')
+	if j < 0 {
+		if strings.HasSuffix(hostAndPath, "-") {
+			return "-", true
+		}
+		return "", false
+	}
+	path := hostAndPath[j:]
+	if k := strings.IndexByte(path, '?'); k >= 0 {
+		path = path[:k]
+	}
+	return path, true
+}
+
+// expandPathTemplate replaces `$1`, `${1}`, `$name` and `${name}` in template with submatches of re.
+// References which are not capture groups of re are left as is, so that templates like `/users/$id` keep working.
+func expandPathTemplate(template string, re *regexp.Regexp, s string, match []int) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(template, '$')
+		if i < 0 {
+			break
+		}
+		b.WriteString(template[:i])
+		template = template[i:]
+
+		if name, rest, ok := pathTemplateReference(template); ok {
+			if index := pathTemplateGroupIndex(re, name); index >= 0 {
+				if match[2*index] >= 0 {
+					b.WriteString(s[match[2*index]:match[2*index+1]])
+				}
+				template = rest
+				continue
+			}
+		}
+		b.WriteByte('$')
+		template = template[1:]
+	}
+	b.WriteString(template)
+	return b.String()
+}
+
+// pathTemplateReference parses the reference at the beginning of template, which starts with `$`.
+func pathTemplateReference(template string) (name string, rest string, ok bool) {
+	isNameChar := func(c byte) bool {
+		return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+	}
+	template = template[1:]
+	if strings.HasPrefix(template, "{") {
+		end := strings.IndexByte(template, '}')
+		if end < 0 {
+			return "", "", false
+		}
+		name = template[1:end]
+		for i := 0; i < len(name); i++ {
+			if !isNameChar(name[i]) {
+				return "", "", false
+			}
+		}
+		return name, template[end+1:], name != ""
+	}
+	i := 0
+	for i < len(template) && isNameChar(template[i]) {
+		i++
+	}
+	return template[:i], template[i:], i > 0
+}
+
+// pathTemplateGroupIndex returns the index of capture group referred by name, or -1 when re doesn't have the group.
+func pathTemplateGroupIndex(re *regexp.Regexp, name string) int {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n <= re.NumSubexp() {
+			return n
+		}
+		return -1
+	}
+	return re.SubexpIndex(name)
+}
+
+// Indexes of fields of ALB log record.
+const (
+	albLogFieldType = iota
+	albLogFieldTime
+	albLogFieldElb
+	albLogFieldClientPort
+	albLogFieldTargetPort
+	albLogFieldRequestProcessingTime
+	albLogFieldTargetProcessingTime
+	albLogFieldResponseProcessingTime
+	albLogFieldElbStatusCode
+	albLogFieldTargetStatusCode
+	albLogFieldReceivedBytes
+	albLogFieldSentBytes
+	albLogFieldRequest
+	albLogFieldUserAgent
+	albLogFieldSslCipher
+	albLogFieldSslProtocol
+	albLogFieldTargetGroupArn
+	albLogFieldTraceId
+	albLogFieldDomainName
+	albLogFieldChosenCertArn
+	albLogFieldMatchedRulePriority
+	albLogFieldRequestCreationTime
+	albLogFieldActionsExecuted
+	albLogFieldRedirectUrl
+	albLogFieldErrorReason
+	albLogFieldTargetPortList
+	albLogFieldTargetStatusCodeList
+	albLogFieldClassification
+	albLogFieldClassificationReason
+	albLogFieldConnTraceId
+	albLogFieldTransformedHost
+	albLogFieldTransformedUri
+	albLogFieldRequestTransformStatus
+
+	albLogFieldCount
+)
+
+// albLogRequiredFieldCount is the number of fields which every ALB log record has.
+// Fields after them were appended by AWS later, so they are optional.
+const albLogRequiredFieldCount = albLogFieldConnTraceId
+
+// albLogQuotedFields is the set of fields enclosed in double quotes, which may include space.
+var albLogQuotedFields = [albLogFieldCount]bool{
+	albLogFieldRequest:                true,
+	albLogFieldUserAgent:              true,
+	albLogFieldTraceId:                true,
+	albLogFieldDomainName:             true,
+	albLogFieldChosenCertArn:          true,
+	albLogFieldActionsExecuted:        true,
+	albLogFieldRedirectUrl:            true,
+	albLogFieldErrorReason:            true,
+	albLogFieldTargetPortList:         true,
+	albLogFieldTargetStatusCodeList:   true,
+	albLogFieldClassification:         true,
+	albLogFieldClassificationReason:   true,
+	albLogFieldTransformedHost:        true,
+	albLogFieldTransformedUri:         true,
+	albLogFieldRequestTransformStatus: true,
+}
+
+// albLogFields is fields of ALB log record. Values are substrings of the line without double quotes.
+type albLogFields [albLogFieldCount]string
+
+// tokenize splits the line into fields of ALB log record.
+func (f *albLogFields) tokenize(line string) error {
+	return tokenizeLogFields(line, f[:], albLogQuotedFields[:], albLogRequiredFieldCount)
+}
+
+// tokenizeLogFields splits the line separated by space into fields without allocation.
+// A quoted field ends with double quote followed by space or end of line.
+// Fields after required fields are optional, which are empty when missing, and unknown fields after known fields are ignored.
+func tokenizeLogFields(line string, fields []string, quoted []bool, required int) error {
+	rest := line
+	for i := range fields {
+		if i >= required && rest == "" {
+			clear(fields[i:])
+			return nil
+		}
+		if i > 0 {
+			if rest == "" || rest[0] != ' ' {
+				return fmt.Errorf("too few fields in log record: %s", line)
+			}
+			rest = rest[1:]
+		}
+
+		if !quoted[i] {
+			end := strings.IndexByte(rest, ' ')
+			if end < 0 {
+				end = len(rest)
+			}
+			fields[i], rest = rest[:end], rest[end:]
+			continue
+		}
+
+		if rest == "" || rest[0] != '"' {
+			return fmt.Errorf("field %d is not quoted in log record: %s", i, line)
+		}
+		end := 1
+		for {
+			j := strings.IndexByte(rest[end:], '"')
+			if j < 0 {
+				return fmt.Errorf("field %d is not closed in log record: %s", i, line)
+			}
+			end += j
+			if end+1 == len(rest) || rest[end+1] == ' ' {
+				break
+			}
+			end++
+		}
+		fields[i], rest = rest[1:end], rest[end+1:]
+	}
+	return nil
+}
 
 // line is ALB's access log record: https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
 // field that is enclosed in double quotes may include space. e.g. `"request"` and `"target:port_list"`.
 func parseAlbLog(line string) (*AlbLogRecord, error) {
-	values := parseAlbLogRe.FindStringSubmatch(line)
-	ts, err := time.Parse(time.RFC3339, values[parseAlbLogRe.SubexpIndex("time")])
-	if err != nil {
+	var fields albLogFields
+	if err := fields.tokenize(line); err != nil {
 		return nil, err
 	}
+	return fields.parse()
+}
 
-	requestProcessingTime, err := strconv.ParseFloat(values[parseAlbLogRe.SubexpIndex("request_processing_time")], 64)
+// parse converts fields into AlbLogRecord.
+func (f *albLogFields) parse() (*AlbLogRecord, error) {
+	values, err := f.parseValues(allLogValueFields)
 	if err != nil {
 		return nil, err
 	}
-	targetProcessingTime, err := strconv.ParseFloat(values[parseAlbLogRe.SubexpIndex("target_processing_time")], 64)
-	if err != nil {
-		return nil, err
+	return f.record(values), nil
+}
+
+// albLogValues is values of fields of ALB log record which aren't strings.
+type albLogValues struct {
+	time                   time.Time
+	requestProcessingTime  float64
+	targetProcessingTime   float64
+	responseProcessingTime float64
+	receivedBytes          int
+	sentBytes              int
+	matchedRulePriority    int
+}
+
+// logValueFields is the set of fields which aren't strings parsed by parseValues of ALB and CLB log record.
+// The time is always parsed, and fields which aren't parsed have zero values.
+type logValueFields struct {
+	requestProcessingTime  bool
+	targetProcessingTime   bool
+	responseProcessingTime bool
+	receivedBytes          bool
+	sentBytes              bool
+	matchedRulePriority    bool
+}
+
+// allLogValueFields parses all fields, which is used to build complete records.
+var allLogValueFields = logValueFields{
+	requestProcessingTime:  true,
+	targetProcessingTime:   true,
+	responseProcessingTime: true,
+	receivedBytes:          true,
+	sentBytes:              true,
+	matchedRulePriority:    true,
+}
+
+// parseValues parses fields of parsed which aren't strings without allocation,
+// so that malformed lines are detected before lines of paths other than target are skipped.
+func (f *albLogFields) parseValues(parsed logValueFields) (albLogValues, error) {
+	var v albLogValues
+	var err error
+	if v.time, err = time.Parse(time.RFC3339, f[albLogFieldTime]); err != nil {
+		return v, err
 	}
-	responseProcessingTime, err := strconv.ParseFloat(values[parseAlbLogRe.SubexpIndex("response_processing_time")], 64)
-	if err != nil {
-		return nil, err
+	if parsed.requestProcessingTime {
+		if v.requestProcessingTime, err = strconv.ParseFloat(f[albLogFieldRequestProcessingTime], 64); err != nil {
+			return v, err
+		}
+	}
+	if parsed.targetProcessingTime {
+		if v.targetProcessingTime, err = strconv.ParseFloat(f[albLogFieldTargetProcessingTime], 64); err != nil {
+			return v, err
+		}
+	}
+	if parsed.responseProcessingTime {
+		if v.responseProcessingTime, err = strconv.ParseFloat(f[albLogFieldResponseProcessingTime], 64); err != nil {
+			return v, err
+		}
+	}
+	if parsed.receivedBytes && f[albLogFieldReceivedBytes] != "-" {
+		if v.receivedBytes, err = strconv.Atoi(f[albLogFieldReceivedBytes]); err != nil {
+			return v, err
+		}
+	}
+	if parsed.sentBytes && f[albLogFieldSentBytes] != "-" {
+		if v.sentBytes, err = strconv.Atoi(f[albLogFieldSentBytes]); err != nil {
+			return v, err
+		}
+	}
+	if parsed.matchedRulePriority && f[albLogFieldMatchedRulePriority] != "-" {
+		if v.matchedRulePriority, err = strconv.Atoi(f[albLogFieldMatchedRulePriority]); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// record converts fields and their parsed values into AlbLogRecord.
+func (f *albLogFields) record(v albLogValues) *AlbLogRecord {
+	return &AlbLogRecord{
+		Type:                   f[albLogFieldType],
+		Time:                   v.time,
+		Elb:                    f[albLogFieldElb],
+		ClientPort:             f[albLogFieldClientPort],
+		TargetPort:             f[albLogFieldTargetPort],
+		RequestProcessingTime:  v.requestProcessingTime,
+		TargetProcessingTime:   v.targetProcessingTime,
+		ResponseProcessingTime: v.responseProcessingTime,
+		ElbStatusCode:          f[albLogFieldElbStatusCode],
+		TargetStatusCode:       f[albLogFieldTargetStatusCode],
+		ReceivedBytes:          v.receivedBytes,
+		SentBytes:              v.sentBytes,
+		Request:                f[albLogFieldRequest],
+		UserAgent:              f[albLogFieldUserAgent],
+		SslCipher:              f[albLogFieldSslCipher],
+		SslProtocol:            f[albLogFieldSslProtocol],
+		TargetGroupArn:         f[albLogFieldTargetGroupArn],
+		TraceId:                f[albLogFieldTraceId],
+		DomainName:             f[albLogFieldDomainName],
+		ChosenCertArn:          f[albLogFieldChosenCertArn],
+		MatchedRulePriority:    v.matchedRulePriority,
+		RequestCreationTime:    f[albLogFieldRequestCreationTime],
+		ActionsExecuted:        f[albLogFieldActionsExecuted],
+		RedirectUrl:            f[albLogFieldRedirectUrl],
+		ErrorReason:            f[albLogFieldErrorReason],
+		TargetPortList:         f[albLogFieldTargetPortList],
+		TargetStatusCodeList:   f[albLogFieldTargetStatusCodeList],
+		Classification:         f[albLogFieldClassification],
+		ClassificationReason:   f[albLogFieldClassificationReason],
+		ConnTraceId:            f[albLogFieldConnTraceId],
+		TransformedHost:        f[albLogFieldTransformedHost],
+		TransformedUri:         f[albLogFieldTransformedUri],
+		RequestTransformStatus: f[albLogFieldRequestTransformStatus],
 	}
-	record := &AlbLogRecord{
-		Type:                   values[parseAlbLogRe.SubexpIndex("type")],
-		Time:                   ts,
-		Elb:                    values[parseAlbLogRe.SubexpIndex("elb")],
-		ClientPort:             values[parseAlbLogRe.SubexpIndex("clientport")],
-		TargetPort:             values[parseAlbLogRe.SubexpIndex("targetport")],
-		RequestProcessingTime:  requestProcessingTime,
-		TargetProcessingTime:   targetProcessingTime,
-		ResponseProcessingTime: responseProcessingTime,
-		ElbStatusCode:          values[parseAlbLogRe.SubexpIndex("elb_status_code")],
-		TargetStatusCode:       values[parseAlbLogRe.SubexpIndex("target_status_code")],
-		Request:                values[parseAlbLogRe.SubexpIndex("request")],
-		UserAgent:              values[parseAlbLogRe.SubexpIndex("user_agent")],
-		SslCipher:              values[parseAlbLogRe.SubexpIndex("ssl_cipher")],
-		SslProtocol:            values[parseAlbLogRe.SubexpIndex("ssl_protocol")],
-		TargetGroupArn:         values[parseAlbLogRe.SubexpIndex("target_group_arn")],
-		TraceId:                values[parseAlbLogRe.SubexpIndex("trace_id")],
-		DomainName:             values[parseAlbLogRe.SubexpIndex("domain_name")],
-		ChosenCertArn:          values[parseAlbLogRe.SubexpIndex("chosen_cert_arn")],
-		RequestCreationTime:    values[parseAlbLogRe.SubexpIndex("request_creation_time")],
-		ActionsExecuted:        values[parseAlbLogRe.SubexpIndex("actions_executed")],
-		RedirectUrl:            values[parseAlbLogRe.SubexpIndex("redirect_url")],
-		ErrorReason:            values[parseAlbLogRe.SubexpIndex("error_reason")],
-		TargetPortList:         values[parseAlbLogRe.SubexpIndex("target_port_list")],
-		TargetStatusCodeList:   values[parseAlbLogRe.SubexpIndex("target_status_code_list")],
-		Classification:         values[parseAlbLogRe.SubexpIndex("classification")],
-		ClassificationReason:   values[parseAlbLogRe.SubexpIndex("classification_reason")],
-	}
-	if values[parseAlbLogRe.SubexpIndex("received_bytes")] != "-" {
-		receiveBytes, err := strconv.Atoi(values[parseAlbLogRe.SubexpIndex("received_bytes")])
-		if err != nil {
-			return nil, err
-		}
-		record.ReceivedBytes = receiveBytes
-	}
-	if values[parseAlbLogRe.SubexpIndex("sent_bytes")] != "-" {
-		sentBytes, err := strconv.Atoi(values[parseAlbLogRe.SubexpIndex("sent_bytes")])
-		if err != nil {
-			return nil, err
-		}
-		record.SentBytes = sentBytes
-	}
-	if values[parseAlbLogRe.SubexpIndex("matched_rule_priority")] != "-" {
-		matchedRulePriority, err := strconv.Atoi(values[parseAlbLogRe.SubexpIndex("matched_rule_priority")])
-		if err != nil {
-			return nil, err
-		}
-		record.MatchedRulePriority = matchedRulePriority
-	}
-	return record, nil
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -11,6 +14,8 @@ import (
 var (
 	exampleHttpEntry                    = `http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`
 	exampleHttpsEntry                   = `https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 200 200 0 57 "GET https://www.example.com:443/ HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337281-1d84f3d73c47ec4e58577259" "www.example.com" "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012" 1 2018-07-02T22:22:48.364000Z "authenticate,forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`
+	exampleNewerFormatEntry             = exampleHttpsEntry + ` TID_1234abcd5678ef90 "www.example.com" "/users?id=123" "TRANSFORMED"`
+	exampleUnknownTrailingFieldsEntry   = exampleNewerFormatEntry + ` "unknown field" - 123`
 	exampleLoadBalancerCouldNotDispatch = `https 2022-06-13T00:26:00.071316Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 - -1 -1 -1 400 - 235 772 "GET https://www.example.com:443/ HTTP/1.1" "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/81.0.4044.129 Safari/537.36" - - - "-" "-" "-" - 2022-06-13T00:25:59.856000Z "-" "-" "-" "-" "-" "-" "-"`
 )
 
@@ -112,6 +117,102 @@ func Test_parseAlbLog(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Entry of newer format with connection trace ID and transformed fields",
+			args: args{
+				line: exampleNewerFormatEntry,
+			},
+			want: &AlbLogRecord{
+				Type: "https",
+				Time: func() time.Time {
+					r, err := time.Parse(time.RFC3339, "2018-07-02T22:23:00.186641Z")
+					if err != nil {
+						t.Fatal(err)
+					}
+					return r
+				}(),
+				Elb:                    "app/my-loadbalancer/50dc6c495c0c9188",
+				ClientPort:             "192.168.131.39:2817",
+				TargetPort:             "10.0.0.1:80",
+				RequestProcessingTime:  0.086,
+				TargetProcessingTime:   0.048,
+				ResponseProcessingTime: 0.037,
+				ElbStatusCode:          "200",
+				TargetStatusCode:       "200",
+				ReceivedBytes:          0,
+				SentBytes:              57,
+				Request:                "GET https://www.example.com:443/ HTTP/1.1",
+				UserAgent:              "curl/7.46.0",
+				SslCipher:              "ECDHE-RSA-AES128-GCM-SHA256",
+				SslProtocol:            "TLSv1.2",
+				TargetGroupArn:         "arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067",
+				TraceId:                "Root=1-58337281-1d84f3d73c47ec4e58577259",
+				DomainName:             "www.example.com",
+				ChosenCertArn:          "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012",
+				MatchedRulePriority:    1,
+				RequestCreationTime:    "2018-07-02T22:22:48.364000Z",
+				ActionsExecuted:        "authenticate,forward",
+				RedirectUrl:            "-",
+				ErrorReason:            "-",
+				TargetPortList:         "10.0.0.1:80",
+				TargetStatusCodeList:   "200",
+				Classification:         "-",
+				ClassificationReason:   "-",
+				ConnTraceId:            "TID_1234abcd5678ef90",
+				TransformedHost:        "www.example.com",
+				TransformedUri:         "/users?id=123",
+				RequestTransformStatus: "TRANSFORMED",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Entry with unknown trailing fields",
+			args: args{
+				line: exampleUnknownTrailingFieldsEntry,
+			},
+			want: &AlbLogRecord{
+				Type: "https",
+				Time: func() time.Time {
+					r, err := time.Parse(time.RFC3339, "2018-07-02T22:23:00.186641Z")
+					if err != nil {
+						t.Fatal(err)
+					}
+					return r
+				}(),
+				Elb:                    "app/my-loadbalancer/50dc6c495c0c9188",
+				ClientPort:             "192.168.131.39:2817",
+				TargetPort:             "10.0.0.1:80",
+				RequestProcessingTime:  0.086,
+				TargetProcessingTime:   0.048,
+				ResponseProcessingTime: 0.037,
+				ElbStatusCode:          "200",
+				TargetStatusCode:       "200",
+				ReceivedBytes:          0,
+				SentBytes:              57,
+				Request:                "GET https://www.example.com:443/ HTTP/1.1",
+				UserAgent:              "curl/7.46.0",
+				SslCipher:              "ECDHE-RSA-AES128-GCM-SHA256",
+				SslProtocol:            "TLSv1.2",
+				TargetGroupArn:         "arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067",
+				TraceId:                "Root=1-58337281-1d84f3d73c47ec4e58577259",
+				DomainName:             "www.example.com",
+				ChosenCertArn:          "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012",
+				MatchedRulePriority:    1,
+				RequestCreationTime:    "2018-07-02T22:22:48.364000Z",
+				ActionsExecuted:        "authenticate,forward",
+				RedirectUrl:            "-",
+				ErrorReason:            "-",
+				TargetPortList:         "10.0.0.1:80",
+				TargetStatusCodeList:   "200",
+				Classification:         "-",
+				ClassificationReason:   "-",
+				ConnTraceId:            "TID_1234abcd5678ef90",
+				TransformedHost:        "www.example.com",
+				TransformedUri:         "/users?id=123",
+				RequestTransformStatus: "TRANSFORMED",
+			},
+			wantErr: false,
+		},
 		{
 			name: "Example HTTPS Entry if LoadBalancer could not dispatch request to target",
 			args: args{
@@ -274,6 +375,38 @@ func TestAlbLogRecord_RequestPath(t *testing.T) {
 			want:    "/foo/$id/bar",
 			wantErr: false,
 		},
+		{
+			name: "regexp with numbered capture group",
+			args: args{
+				paths: []PathTransformingRule{
+					{
+						Regexp:      regexp.MustCompile(`^/api/v1/users/([^/]+)/items/[^/]+$`),
+						Transformed: "/api/v1/users/$1/items/$id",
+					},
+				},
+			},
+			fields: fields{
+				Request: "GET https://example.com:443/api/v1/users/me/items/123 HTTP/1.1",
+			},
+			want:    "/api/v1/users/me/items/$id",
+			wantErr: false,
+		},
+		{
+			name: "regexp with named capture group",
+			args: args{
+				paths: []PathTransformingRule{
+					{
+						Regexp:      regexp.MustCompile(`^/api/(?P<version>v\d+)/users/[^/]+$`),
+						Transformed: "/api/${version}/users/${2}$",
+					},
+				},
+			},
+			fields: fields{
+				Request: "GET https://example.com:443/api/v2/users/123 HTTP/1.1",
+			},
+			want:    "/api/v2/users/${2}$",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -290,3 +423,247 @@ func TestAlbLogRecord_RequestPath(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseAlbLog_malformed(t *testing.T) {
+	lines := []string{
+		"",
+		"garbage",
+		`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 "`,
+		strings.Replace(exampleHttpEntry, "2018-07-02T22:23:00.186641Z", "yesterday", 1),
+		strings.Replace(exampleHttpEntry, " 0.000 0.001 0.000 ", " 0.000 fast 0.000 ", 1),
+		strings.Replace(exampleHttpEntry, `"GET http://www.example.com:80/ HTTP/1.1"`, `"GET"`, 1),
+		strings.Replace(exampleNewerFormatEntry, `"www.example.com" "/users`, `www.example.com "/users`, 1),
+	}
+	for _, line := range lines {
+		if _, err := NewAlbLogRecord(line, nil); err == nil {
+			t.Errorf("NewAlbLogRecord() error = nil for %q", line)
+		}
+	}
+}
+
+func Test_albLogFields_tokenize_reused(t *testing.T) {
+	var fields albLogFields
+	if err := fields.tokenize(exampleNewerFormatEntry); err != nil {
+		t.Fatal(err)
+	}
+	if err := fields.tokenize(exampleHttpsEntry); err != nil {
+		t.Fatal(err)
+	}
+	for i := albLogRequiredFieldCount; i < albLogFieldCount; i++ {
+		if fields[i] != "" {
+			t.Errorf("field %d got = %v, want empty for older format", i, fields[i])
+		}
+	}
+}
+
+// parseAlbLogRe is the former regexp to parse ALB log record, which is kept as the reference of tokenize and parse.
+var parseAlbLogRe = func() *regexp.Regexp {
+	s := []string{
+		`(?P<type>.*?)`,
+		`(?P<time>.*?)`,
+		`(?P<elb>.*?)`,
+		`(?P<clientport>.*?)`,
+		`(?P<targetport>.*?)`,
+		`(?P<request_processing_time>.*?)`,
+		`(?P<target_processing_time>.*?)`,
+		`(?P<response_processing_time>.*?)`,
+		`(?P<elb_status_code>.*?)`,
+		`(?P<target_status_code>.*?)`,
+		`(?P<received_bytes>.*?)`,
+		`(?P<sent_bytes>.*?)`,
+		`"(?P<request>.*?)"`,
+		`"(?P<user_agent>.*?)"`,
+		`(?P<ssl_cipher>.*?)`,
+		`(?P<ssl_protocol>.*?)`,
+		`(?P<target_group_arn>.*?)`,
+		`"(?P<trace_id>.*?)"`,
+		`"(?P<domain_name>.*?)"`,
+		`"(?P<chosen_cert_arn>.*?)"`,
+		`(?P<matched_rule_priority>.*?)`,
+		`(?P<request_creation_time>.*?)`,
+		`"(?P<actions_executed>.*?)"`,
+		`"(?P<redirect_url>.*?)"`,
+		`"(?P<error_reason>.*?)"`,
+		`"(?P<target_port_list>.*?)"`,
+		`"(?P<target_status_code_list>.*?)"`,
+		`"(?P<classification>.*?)"`,
+		`"(?P<classification_reason>.*?)"`,
+	}
+	return regexp.MustCompile(strings.Join(s, `\s`))
+}()
+
+// requestPathRegexp is the former regexp to get path from request field, which is kept as the reference of requestUriPath.
+var requestPathRegexp = regexp.MustCompile(`(?P<method>.*) (?P<protocol>.*)://(?P<host>[^:]*):?(?P<port>\d*)(?P<path>-|/[^\?]*)\??(?P<query_param>.*) (?P<http_version>.*)`)
+
+// parseAlbLogByRegexp is the former parser of ALB log record, which builds the whole record from submatches of parseAlbLogRe.
+func parseAlbLogByRegexp(line string) (*AlbLogRecord, error) {
+	values := parseAlbLogRe.FindStringSubmatch(line)
+	if values == nil {
+		return nil, fmt.Errorf("no match regexp: %s", line)
+	}
+	value := func(name string) string {
+		return values[parseAlbLogRe.SubexpIndex(name)]
+	}
+	ts, err := time.Parse(time.RFC3339, value("time"))
+	if err != nil {
+		return nil, err
+	}
+	requestProcessingTime, err := strconv.ParseFloat(value("request_processing_time"), 64)
+	if err != nil {
+		return nil, err
+	}
+	targetProcessingTime, err := strconv.ParseFloat(value("target_processing_time"), 64)
+	if err != nil {
+		return nil, err
+	}
+	responseProcessingTime, err := strconv.ParseFloat(value("response_processing_time"), 64)
+	if err != nil {
+		return nil, err
+	}
+	record := &AlbLogRecord{
+		Type:                   value("type"),
+		Time:                   ts,
+		Elb:                    value("elb"),
+		ClientPort:             value("clientport"),
+		TargetPort:             value("targetport"),
+		RequestProcessingTime:  requestProcessingTime,
+		TargetProcessingTime:   targetProcessingTime,
+		ResponseProcessingTime: responseProcessingTime,
+		ElbStatusCode:          value("elb_status_code"),
+		TargetStatusCode:       value("target_status_code"),
+		Request:                value("request"),
+		UserAgent:              value("user_agent"),
+		SslCipher:              value("ssl_cipher"),
+		SslProtocol:            value("ssl_protocol"),
+		TargetGroupArn:         value("target_group_arn"),
+		TraceId:                value("trace_id"),
+		DomainName:             value("domain_name"),
+		ChosenCertArn:          value("chosen_cert_arn"),
+		RequestCreationTime:    value("request_creation_time"),
+		ActionsExecuted:        value("actions_executed"),
+		RedirectUrl:            value("redirect_url"),
+		ErrorReason:            value("error_reason"),
+		TargetPortList:         value("target_port_list"),
+		TargetStatusCodeList:   value("target_status_code_list"),
+		Classification:         value("classification"),
+		ClassificationReason:   value("classification_reason"),
+	}
+	if value("received_bytes") != "-" {
+		if record.ReceivedBytes, err = strconv.Atoi(value("received_bytes")); err != nil {
+			return nil, err
+		}
+	}
+	if value("sent_bytes") != "-" {
+		if record.SentBytes, err = strconv.Atoi(value("sent_bytes")); err != nil {
+			return nil, err
+		}
+	}
+	if value("matched_rule_priority") != "-" {
+		if record.MatchedRulePriority, err = strconv.Atoi(value("matched_rule_priority")); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+func FuzzParseAlbLog(f *testing.F) {
+	f.Add("/", "curl/7.46.0", "Root=1-58337262-36d228ad5d99923122bbe354", "-")
+	f.Add("/api/v1/foo?bar=baz", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko)", "-", "-")
+	f.Add("/api/v1/hoge/123/start", "", "Root=1-58337262-36d228ad5d99923122bbe354", "TargetConnectionErrorCode")
+	f.Add("/a b?c", " ", "", " spaces ")
+	f.Fuzz(func(t *testing.T, path, userAgent, traceId, errorReason string) {
+		// Values must be valid for both parsers: quoted values have no double quote and whitespace other than space,
+		// and path has no colon which the regexp confuses with port.
+		sanitize := func(s, removed string) string {
+			return strings.Map(func(r rune) rune {
+				if strings.ContainsRune(removed, r) {
+					return -1
+				}
+				return r
+			}, strings.ToValidUTF8(s, ""))
+		}
+		const invalid = "\"\t\n\v\f\r"
+		path = "/" + sanitize(path, invalid+":")
+		line := strings.Join([]string{
+			`https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 200 200 0 57`,
+			`"GET https://www.example.com:443` + path + ` HTTP/1.1"`,
+			`"` + sanitize(userAgent, invalid) + `"`,
+			`ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067`,
+			`"` + sanitize(traceId, invalid) + `"`,
+			`"www.example.com" "-" 1 2018-07-02T22:22:48.364000Z "forward" "-"`,
+			`"` + sanitize(errorReason, invalid) + `"`,
+			`"10.0.0.1:80" "200" "-" "-"`,
+		}, " ")
+
+		want, err := parseAlbLogByRegexp(line)
+		if err != nil {
+			t.Fatalf("parseAlbLogByRegexp() error = %v", err)
+		}
+		got, err := parseAlbLog(line)
+		if err != nil {
+			t.Fatalf("parseAlbLog() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseAlbLog() got = %+v, want %+v", got, want)
+		}
+
+		values := requestPathRegexp.FindStringSubmatch(want.Request)
+		if values == nil {
+			t.Fatalf("requestPathRegexp doesn't match: %s", want.Request)
+		}
+		gotPath, ok := requestUriPath(got.Request)
+		if !ok || gotPath != values[requestPathRegexp.SubexpIndex("path")] {
+			t.Errorf("requestUriPath() got = %v, %v, want %v", gotPath, ok, values[requestPathRegexp.SubexpIndex("path")])
+		}
+	})
+}
+
+func BenchmarkParseAlbLog(b *testing.B) {
+	b.Run("tokenizer", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := parseAlbLog(exampleHttpsEntry); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("regexp", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := parseAlbLogByRegexp(exampleHttpsEntry); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// reader parses only fields of the default metrics, request count and target processing time.
+	b.Run("reader", func(b *testing.B) {
+		reader := NewLogFileReader(&Config{TargetPaths: []string{"/"}, RequestCountMetricName: "request_count", TargetProcessingTimeMetricName: "target_processing_time"})
+		var fields albLogFields
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := reader.readRecord(exampleHttpsEntry, &fields); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkRequestPath(b *testing.B) {
+	request := "GET https://www.example.com:443/api/v1/foo?bar=baz HTTP/1.1"
+	b.Run("tokenizer", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, ok := requestUriPath(request); !ok {
+				b.Fatal("no path")
+			}
+		}
+	})
+	b.Run("regexp", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if values := requestPathRegexp.FindStringSubmatch(request); values == nil {
+				b.Fatal("no path")
+			}
+		}
+	})
+}
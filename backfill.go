@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultBackfillConcurrency = 4
+
+	// logFileTimestampLayout is the layout of the end time of the interval encoded in the name of log file.
+	logFileTimestampLayout = "20060102T1504Z"
+)
+
+// BackfillS3Client lists and gets log files from S3. It is implemented by *s3.Client.
+type BackfillS3Client interface {
+	ObjectGetter
+	s3.ListObjectsV2APIClient
+}
+
+// Backfiller reprocesses log files in S3 whose timestamp in the file name is in the time range.
+type Backfiller struct {
+	handler     *EventHandler
+	s3          BackfillS3Client
+	concurrency int
+}
+
+// BackfillTarget is the range of log files to reprocess.
+type BackfillTarget struct {
+	Bucket string
+	// Prefix is the prefix configured in access log attributes of load balancer, which is empty by default.
+	Prefix    string
+	AccountId string
+	Region    string
+	// Start is inclusive and End is exclusive.
+	Start time.Time
+	End   time.Time
+}
+
+func NewBackfiller(processor *Processor, client BackfillS3Client, concurrency int) *Backfiller {
+	if concurrency <= 0 {
+		concurrency = defaultBackfillConcurrency
+	}
+	return &Backfiller{
+		handler:     &EventHandler{Processor: processor, S3: client},
+		s3:          client,
+		concurrency: concurrency,
+	}
+}
+
+// Run processes all of log files in the target with bounded parallelism.
+// Metrics of log files of the same interval (e.g. written by multiple nodes) are merged and submitted at once,
+// and each interval is submitted before reading the next so that memory doesn't grow with the time range.
+// A failure of a file doesn't stop processing other files, and the number of failed files is returned as error.
+func (b *Backfiller) Run(ctx context.Context, target BackfillTarget) error {
+	groups, err := b.list(ctx, target)
+	if err != nil {
+		return err
+	}
+	var total int
+	for _, objects := range groups {
+		total += len(objects)
+	}
+	fmt.Fprintf(os.Stderr, "found %d log files from %s to %s\n", total, target.Start.Format(time.RFC3339), target.End.Format(time.RFC3339))
+
+	var done, failed atomic.Int64
+	for _, objects := range groups {
+		logMetrics, read := b.read(ctx, objects, total, &done, &failed)
+		if err := b.handler.submit(logMetrics); err != nil {
+			failed.Add(int64(read))
+			fmt.Fprintf(os.Stderr, "failed to submit metrics of %d log files: %s\n", read, err)
+		}
+	}
+
+	if n := failed.Load(); n > 0 {
+		return fmt.Errorf("failed to process %d of %d log files", n, total)
+	}
+	return nil
+}
+
+// read reads log files concurrently and merges their metrics, returning the number of log files read successfully.
+func (b *Backfiller) read(ctx context.Context, objects []S3Object, total int, done *atomic.Int64, failed *atomic.Int64) (*LogMetrics, int) {
+	var eg errgroup.Group
+	eg.SetLimit(b.concurrency)
+	results := make([]*LogMetrics, len(objects))
+	for i, object := range objects {
+		eg.Go(func() error {
+			logMetrics, err := b.handler.readObject(ctx, object)
+			n := done.Add(1)
+			if err != nil {
+				failed.Add(1)
+				fmt.Fprintf(os.Stderr, "[%d/%d] failed to process %s: %s\n", n, total, object.Key, err)
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] read %s\n", n, total, object.Key)
+			results[i] = logMetrics
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	merged := NewLogMetrics()
+	var read int
+	for _, logMetrics := range results {
+		if logMetrics != nil {
+			merged.Merge(logMetrics)
+			read++
+		}
+	}
+	return merged, read
+}
+
+// list returns log files in the target, listing the prefix of each day.
+// Log files are grouped by the interval of their timestamp in the file name, in ascending order of the timestamp.
+func (b *Backfiller) list(ctx context.Context, target BackfillTarget) ([][]S3Object, error) {
+	intervals := map[time.Time][]S3Object{}
+	for _, prefix := range backfillPrefixes(target) {
+		paginator := s3.NewListObjectsV2Paginator(b.s3, &s3.ListObjectsV2Input{
+			Bucket: &target.Bucket,
+			Prefix: &prefix,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list s3://%s/%s: %w", target.Bucket, prefix, err)
+			}
+			for _, content := range page.Contents {
+				key := aws.ToString(content.Key)
+				timestamp, ok := logFileTimestamp(key)
+				if !ok || timestamp.Before(target.Start) || !timestamp.Before(target.End) {
+					continue
+				}
+				intervals[timestamp] = append(intervals[timestamp], S3Object{Bucket: target.Bucket, Key: key, Size: content.Size, ETag: aws.ToString(content.ETag)})
+			}
+		}
+	}
+
+	timestamps := slices.SortedFunc(maps.Keys(intervals), time.Time.Compare)
+	groups := make([][]S3Object, 0, len(timestamps))
+	for _, timestamp := range timestamps {
+		groups = append(groups, intervals[timestamp])
+	}
+	return groups, nil
+}
+
+// backfillPrefixes returns prefixes of log files of each day in the target.
+// see: https://docs.aws.amazon.com/elasticloadbalancing/latest/application/enable-access-logging.html#access-log-file-format
+func backfillPrefixes(target BackfillTarget) []string {
+	base := "AWSLogs/" + target.AccountId + "/elasticloadbalancing/" + target.Region + "/"
+	if target.Prefix != "" {
+		base = strings.TrimSuffix(target.Prefix, "/") + "/" + base
+	}
+
+	var prefixes []string
+	start := target.Start.UTC().Truncate(24 * time.Hour)
+	for day := start; day.Before(target.End); day = day.AddDate(0, 0, 1) {
+		prefixes = append(prefixes, base+day.Format("2006/01/02")+"/")
+	}
+	return prefixes
+}
+
+// logFileTimestamp returns the timestamp encoded in the name of log file like
+// `123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20180702T2225Z_172.160.001.192_20sg8hgm.log.gz`.
+func logFileTimestamp(key string) (time.Time, bool) {
+	fields := logFileNameFields(key)
+	if len(fields) < 5 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(logFileTimestampLayout, fields[4])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// backfillCommand runs `backfill` subcommand.
+func backfillCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	var target BackfillTarget
+	fs.StringVar(&target.Bucket, "bucket", "", "S3 bucket of access logs (required)")
+	fs.StringVar(&target.Prefix, "prefix", "", "Prefix of access logs configured in load balancer")
+	fs.StringVar(&target.AccountId, "account-id", "", "AWS account ID of load balancer (required)")
+	fs.StringVar(&target.Region, "region", "", "Region of load balancer (required)")
+	start := fs.String("start", "", "Start of time range, inclusive. RFC3339 or YYYY-MM-DD in UTC (required)")
+	end := fs.String("end", "", "End of time range, exclusive. RFC3339 or YYYY-MM-DD in UTC (default: now)")
+	concurrency := fs.Int("concurrency", defaultBackfillConcurrency, "Max number of log files processed concurrently")
+	endpointUrl := fs.String("endpoint-url", "", "Endpoint of S3 compatible storage, accessed with path-style")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if target.Bucket == "" || target.AccountId == "" || target.Region == "" || *start == "" {
+		fs.Usage()
+		return errors.New("-bucket, -account-id, -region and -start are required")
+	}
+	var err error
+	if target.Start, err = parseBackfillTime(*start); err != nil {
+		return err
+	}
+	target.End = time.Now()
+	if *end != "" {
+		if target.End, err = parseBackfillTime(*end); err != nil {
+			return err
+		}
+	}
+	if !target.Start.Before(target.End) {
+		return fmt.Errorf("-start must be before -end: %s, %s", target.Start, target.End)
+	}
+
+	appConfig, err := NewConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	processor, err := NewProcessor(appConfig)
+	if err != nil {
+		return err
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if cfg.Region == "" {
+		cfg.Region = target.Region
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if *endpointUrl != "" {
+			o.BaseEndpoint = endpointUrl
+			o.UsePathStyle = true
+		}
+	})
+
+	return NewBackfiller(processor, client, *concurrency).Run(ctx, target)
+}
+
+func parseBackfillTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("time must be RFC3339 or YYYY-MM-DD: %s", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// newFakeS3Server returns the S3 compatible server serving objects of a bucket with path-style requests.
+// ListObjectsV2 returns 2 objects per page to test pagination.
+func newFakeS3Server(t *testing.T, bucket string, objects map[string][]byte) *httptest.Server {
+	t.Helper()
+	keys := slices.Sorted(maps.Keys(objects))
+
+	type content struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+	}
+	type listBucketResult struct {
+		XMLName               xml.Name  `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name                  string    `xml:"Name"`
+		Prefix                string    `xml:"Prefix"`
+		KeyCount              int       `xml:"KeyCount"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+		Contents              []content `xml:"Contents"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/"+bucket && r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			var matched []string
+			for _, key := range keys {
+				if strings.HasPrefix(key, prefix) {
+					matched = append(matched, key)
+				}
+			}
+			start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+			end := min(start+2, len(matched))
+			result := listBucketResult{Name: bucket, Prefix: prefix, KeyCount: end - start}
+			for _, key := range matched[start:end] {
+				result.Contents = append(result.Contents, content{Key: key, Size: len(objects[key])})
+			}
+			if end < len(matched) {
+				result.IsTruncated = true
+				result.NextContinuationToken = strconv.Itoa(end)
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			if err := xml.NewEncoder(w).Encode(result); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+
+		body, ok := objects[strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBackfiller_Run(t *testing.T) {
+	prefix := "AWSLogs/123456789012/elasticloadbalancing/us-east-2/"
+	logFile := func(day string, timestamp string, ipAddress string) string {
+		return prefix + day + "/123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_" + timestamp + "_" + ipAddress + "_20sg8hgm.log.gz"
+	}
+	body := gzipBytes(t, exampleHttpEntry+"\n").Bytes()
+	objects := map[string][]byte{
+		logFile("2018/07/01", "20180701T2355Z", "172.160.001.192"): body,
+		logFile("2018/07/02", "20180702T0000Z", "172.160.001.192"): body,
+		logFile("2018/07/02", "20180702T0005Z", "172.160.001.192"): body,
+		logFile("2018/07/02", "20180702T0005Z", "172.160.001.193"): body,
+		logFile("2018/07/02", "20180702T0010Z", "172.160.001.192"): body,
+		logFile("2018/07/03", "20180703T0000Z", "172.160.001.192"): body,
+		logFile("2018/07/03", "20180703T0005Z", "172.160.001.192"): []byte("broken"),
+		logFile("2018/07/03", "20180703T0010Z", "172.160.001.192"): body,
+		prefix + "2018/07/03/ELBAccessLogTestFile":                 []byte("test"),
+	}
+	server := newFakeS3Server(t, "my-bucket", objects)
+	client := s3.New(s3.Options{
+		Region:       "us-east-2",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  aws.AnonymousCredentials{},
+	})
+
+	processor, sink := newTestProcessor(&Config{TargetProcessingTimeMetricName: "target_processing_time", TargetPaths: []string{"/"}})
+
+	target := BackfillTarget{
+		Bucket:    "my-bucket",
+		AccountId: "123456789012",
+		Region:    "us-east-2",
+		Start:     time.Date(2018, 7, 2, 0, 5, 0, 0, time.UTC),
+		End:       time.Date(2018, 7, 3, 0, 10, 0, 0, time.UTC),
+	}
+	err := NewBackfiller(processor, client, 2).Run(context.Background(), target)
+	if err == nil || err.Error() != "failed to process 1 of 5 log files" {
+		t.Errorf("Run() error = %v", err)
+	}
+	// Log files of 20180702T0005Z, 20180702T0010Z and 20180703T0000Z are processed, and 20180703T0005Z is broken.
+	// Metrics are submitted for each interval, and 2 log files of 20180702T0005Z are submitted at once.
+	if sink.calls != 3 || len(sink.series) != 4 {
+		t.Errorf("Run() submits %d series in %d calls, want 4 series in 3 calls", len(sink.series), sink.calls)
+	}
+}
+
+func Test_backfillPrefixes(t *testing.T) {
+	got := backfillPrefixes(BackfillTarget{
+		Prefix:    "my-prefix/",
+		AccountId: "123456789012",
+		Region:    "us-east-2",
+		Start:     time.Date(2018, 6, 30, 23, 0, 0, 0, time.UTC),
+		End:       time.Date(2018, 7, 2, 0, 0, 0, 0, time.UTC),
+	})
+	want := []string{
+		"my-prefix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/06/30/",
+		"my-prefix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/07/01/",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("backfillPrefixes() = %v, want %v", got, want)
+	}
+}
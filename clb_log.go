@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClbLogRecord is CLB's access log record, whose layout is shorter than ALB's.
+// see: https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html
+type ClbLogRecord struct {
+	Time                   time.Time
+	Elb                    string
+	ClientPort             string
+	BackendPort            string
+	RequestProcessingTime  float64
+	BackendProcessingTime  float64
+	ResponseProcessingTime float64
+	ElbStatusCode          string
+	BackendStatusCode      string
+	ReceivedBytes          int
+	SentBytes              int
+	Request                string
+	UserAgent              string
+	SslCipher              string
+	SslProtocol            string
+
+	// Fields from parsing Request.
+	RequestMethod string
+	RequestPath   string
+}
+
+// Indexes of fields of CLB log record.
+const (
+	clbLogFieldTime = iota
+	clbLogFieldElb
+	clbLogFieldClientPort
+	clbLogFieldBackendPort
+	clbLogFieldRequestProcessingTime
+	clbLogFieldBackendProcessingTime
+	clbLogFieldResponseProcessingTime
+	clbLogFieldElbStatusCode
+	clbLogFieldBackendStatusCode
+	clbLogFieldReceivedBytes
+	clbLogFieldSentBytes
+	clbLogFieldRequest
+	clbLogFieldUserAgent
+	clbLogFieldSslCipher
+	clbLogFieldSslProtocol
+
+	clbLogFieldCount
+)
+
+// clbLogQuotedFields is the set of fields enclosed in double quotes, which may include space.
+var clbLogQuotedFields = [clbLogFieldCount]bool{
+	clbLogFieldRequest:   true,
+	clbLogFieldUserAgent: true,
+}
+
+// clbLogFields is fields of CLB log record. Values are substrings of the line without double quotes.
+type clbLogFields [clbLogFieldCount]string
+
+func (f *clbLogFields) tokenize(line string) error {
+	return tokenizeLogFields(line, f[:], clbLogQuotedFields[:], clbLogFieldCount)
+}
+
+// clbErrorReason is the error reason of requests without response from backend, which CLB's log doesn't have.
+const clbErrorReason = "-"
+
+// clbTcpRequest is the request field of TCP listeners, which has no method and path.
+const clbTcpRequest = "- - - "
+
+// requestPath returns the path of request field transformed by rules, which is empty for TCP listeners.
+func (f *clbLogFields) requestPath(rules []PathTransformingRule) (string, error) {
+	if f[clbLogFieldRequest] == clbTcpRequest {
+		return "", nil
+	}
+	return transformRequestPath(f[clbLogFieldRequest], rules)
+}
+
+// parse converts fields into ClbLogRecord. The request path is set by the caller.
+func (f *clbLogFields) parse() (*ClbLogRecord, error) {
+	values, err := f.parseValues(allLogValueFields)
+	if err != nil {
+		return nil, err
+	}
+	return f.record(values), nil
+}
+
+// clbLogValues is values of fields of CLB log record which aren't strings.
+type clbLogValues struct {
+	time                   time.Time
+	requestProcessingTime  float64
+	backendProcessingTime  float64
+	responseProcessingTime float64
+	receivedBytes          int
+	sentBytes              int
+}
+
+// parseValues parses fields of parsed which aren't strings in the same way as albLogFields.parseValues.
+// CLB log record has no matched rule priority.
+func (f *clbLogFields) parseValues(parsed logValueFields) (clbLogValues, error) {
+	var v clbLogValues
+	var err error
+	if v.time, err = time.Parse(time.RFC3339, f[clbLogFieldTime]); err != nil {
+		return v, err
+	}
+	if parsed.requestProcessingTime {
+		if v.requestProcessingTime, err = strconv.ParseFloat(f[clbLogFieldRequestProcessingTime], 64); err != nil {
+			return v, err
+		}
+	}
+	if parsed.targetProcessingTime {
+		if v.backendProcessingTime, err = strconv.ParseFloat(f[clbLogFieldBackendProcessingTime], 64); err != nil {
+			return v, err
+		}
+	}
+	if parsed.responseProcessingTime {
+		if v.responseProcessingTime, err = strconv.ParseFloat(f[clbLogFieldResponseProcessingTime], 64); err != nil {
+			return v, err
+		}
+	}
+	if parsed.receivedBytes {
+		if v.receivedBytes, err = strconv.Atoi(f[clbLogFieldReceivedBytes]); err != nil {
+			return v, err
+		}
+	}
+	if parsed.sentBytes {
+		if v.sentBytes, err = strconv.Atoi(f[clbLogFieldSentBytes]); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+// record converts fields and their parsed values into ClbLogRecord.
+func (f *clbLogFields) record(v clbLogValues) *ClbLogRecord {
+	return &ClbLogRecord{
+		Time:                   v.time,
+		Elb:                    f[clbLogFieldElb],
+		ClientPort:             f[clbLogFieldClientPort],
+		BackendPort:            f[clbLogFieldBackendPort],
+		RequestProcessingTime:  v.requestProcessingTime,
+		BackendProcessingTime:  v.backendProcessingTime,
+		ResponseProcessingTime: v.responseProcessingTime,
+		ElbStatusCode:          f[clbLogFieldElbStatusCode],
+		BackendStatusCode:      f[clbLogFieldBackendStatusCode],
+		ReceivedBytes:          v.receivedBytes,
+		SentBytes:              v.sentBytes,
+		Request:                f[clbLogFieldRequest],
+		UserAgent:              f[clbLogFieldUserAgent],
+		SslCipher:              f[clbLogFieldSslCipher],
+		SslProtocol:            f[clbLogFieldSslProtocol],
+		RequestMethod:          strings.Split(f[clbLogFieldRequest], " ")[0],
+	}
+}
+
+// parseClbLog parses CLB's access log record with the request path transformed by rules.
+func parseClbLog(line string, rules []PathTransformingRule) (*ClbLogRecord, error) {
+	var fields clbLogFields
+	if err := fields.tokenize(line); err != nil {
+		return nil, err
+	}
+	path, err := fields.requestPath(rules)
+	if err != nil {
+		return nil, err
+	}
+	r, err := fields.parse()
+	if err != nil {
+		return nil, err
+	}
+	r.RequestPath = path
+	return r, nil
+}
+
+func (r *ClbLogRecord) Timestamp() Timestamp {
+	return Timestamp(r.Time.Unix())
+}
+
+func (r *ClbLogRecord) MetricKey() string {
+	return fmt.Sprintf("%s_%s_%s_%s_%s", r.Elb, r.RequestMethod, r.RequestPath, r.ElbStatusCode, r.BackendStatusCode)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"slices"
+)
+
+// ReadClb reads CLB log file and aggregates metrics of target paths into Metric as well as Read.
+// Backend processing time and status code of CLB are mapped into target processing time and status code of Metric.
+func (p *LogFileReader) ReadClb(r io.Reader) (*ReadResult, error) {
+	scanner := bufio.NewScanner(r)
+
+	result := &ReadResult{Metrics: map[string]*Metric{}}
+	metricMap := result.Metrics
+	var fields clbLogFields
+	for scanner.Scan() {
+		text := scanner.Text()
+		result.Lines++
+		r, err := p.readClbRecord(text, &fields)
+		if err != nil {
+			if err := p.skipMalformedLine(result, text, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if r == nil {
+			continue
+		}
+
+		metricKey := r.MetricKey()
+		if _, ok := metricMap[metricKey]; !ok {
+			metricMap[metricKey] = &Metric{
+				RequestCountMap:            map[Timestamp]RequestCount{},
+				TargetProcessingTimesMap:   map[Timestamp]TargetProcessingTimes{},
+				RequestProcessingTimesMap:  map[Timestamp][]float64{},
+				ResponseProcessingTimesMap: map[Timestamp][]float64{},
+				TotalLatenciesMap:          map[Timestamp][]float64{},
+				ReceivedBytesMap:           map[Timestamp]int{},
+				SentBytesMap:               map[Timestamp]int{},
+				RequestSizesMap:            map[Timestamp][]float64{},
+				ResponseSizesMap:           map[Timestamp][]float64{},
+				NoTargetResponseCountsMap:  map[string]map[Timestamp]int{},
+				Method:                     r.RequestMethod,
+				Path:                       r.RequestPath,
+				ElbStatusCode:              r.ElbStatusCode,
+				TargetStatusCode:           r.BackendStatusCode,
+				Elb:                        r.Elb,
+				LogType:                    LogTypeClb,
+			}
+		}
+		metricMap[metricKey].addRequest(r.Timestamp(), p.collected, requestValues{
+			requestProcessingTime:  r.RequestProcessingTime,
+			targetProcessingTime:   r.BackendProcessingTime,
+			responseProcessingTime: r.ResponseProcessingTime,
+			receivedBytes:          r.ReceivedBytes,
+			sentBytes:              r.SentBytes,
+			errorReason:            clbErrorReason,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.checkMalformedLines(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readClbRecord parses the line into fields and returns nil record when the path isn't target.
+// Values of fields used by configured metrics are parsed before filtering by the path in the same way as readRecord.
+func (p *LogFileReader) readClbRecord(line string, fields *clbLogFields) (*ClbLogRecord, error) {
+	if err := fields.tokenize(line); err != nil {
+		return nil, err
+	}
+	values, err := fields.parseValues(p.valueFields)
+	if err != nil {
+		return nil, err
+	}
+	path, err := fields.requestPath(p.pathTransformingRules)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(p.targetPaths, path) {
+		return nil, nil
+	}
+	r := fields.record(values)
+	r.RequestPath = path
+	return r, nil
+}
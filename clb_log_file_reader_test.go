@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogFileReader_ReadClb(t *testing.T) {
+	reader := NewLogFileReader(&Config{
+		TargetPaths:                      []string{"/"},
+		TargetProcessingTimeMetricName:   "target_processing_time",
+		RequestProcessingTimeMetricName:  "request_processing_time",
+		ResponseProcessingTimeMetricName: "response_processing_time",
+		TotalLatencyMetricName:           "total_latency",
+		ReceivedBytesMetricName:          "received_bytes",
+		SentBytesMetricName:              "sent_bytes",
+		RequestSizeMetricName:            "request_size",
+		ResponseSizeMetricName:           "response_size",
+		NoTargetResponseCountMetricName:  "no_target_response_count",
+	})
+	lines := []string{exampleClbHttpEntry, exampleClbTcpEntry, exampleClbHttpEntry, exampleClbNoBackend}
+	got, err := reader.ReadClb(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("ReadClb() error = %v", err)
+	}
+	if got.Lines != 4 || len(got.Metrics) != 2 {
+		t.Fatalf("ReadClb() reads %d lines into %d metrics, want 4 lines into 2 metrics", got.Lines, len(got.Metrics))
+	}
+
+	timestamp := Timestamp(1431560383)
+	requestProcessingTime, backendProcessingTime, responseProcessingTime := 0.000073, 0.001048, 0.000057
+	total := requestProcessingTime + backendProcessingTime + responseProcessingTime
+	want := &Metric{
+		RequestCountMap:            map[Timestamp]RequestCount{timestamp: 2},
+		TargetProcessingTimesMap:   map[Timestamp]TargetProcessingTimes{timestamp: {0.001048, 0.001048}},
+		RequestProcessingTimesMap:  map[Timestamp][]float64{timestamp: {0.000073, 0.000073}},
+		ResponseProcessingTimesMap: map[Timestamp][]float64{timestamp: {0.000057, 0.000057}},
+		TotalLatenciesMap:          map[Timestamp][]float64{timestamp: {total, total}},
+		ReceivedBytesMap:           map[Timestamp]int{timestamp: 0},
+		SentBytesMap:               map[Timestamp]int{timestamp: 58},
+		RequestSizesMap:            map[Timestamp][]float64{timestamp: {0, 0}},
+		ResponseSizesMap:           map[Timestamp][]float64{timestamp: {29, 29}},
+		NoTargetResponseCountsMap:  map[string]map[Timestamp]int{},
+		Method:                     "GET",
+		Path:                       "/",
+		ElbStatusCode:              "200",
+		TargetStatusCode:           "200",
+		Elb:                        "my-loadbalancer",
+		LogType:                    LogTypeClb,
+	}
+	if metric := got.Metrics["my-loadbalancer_GET_/_200_200"]; !reflect.DeepEqual(metric, want) {
+		t.Errorf("ReadClb() got = %+v, want %+v", metric, want)
+	}
+	if metric := got.Metrics["my-loadbalancer_GET_/_503_0"]; metric == nil || len(metric.TargetProcessingTimesMap) != 0 || len(metric.TotalLatenciesMap) != 0 ||
+		!reflect.DeepEqual(metric.NoTargetResponseCountsMap, map[string]map[Timestamp]int{"-": {timestamp: 1}}) {
+		t.Errorf("ReadClb() got = %+v for request not dispatched to backend", metric)
+	}
+}
+
+func TestLogFileReader_ReadClb_malformedLine(t *testing.T) {
+	reader := NewLogFileReader(&Config{TargetPaths: []string{"/"}})
+	if _, err := reader.ReadClb(strings.NewReader(exampleClbHttpEntry + "\ngarbage")); err == nil {
+		t.Error("ReadClb() error = nil")
+	}
+	// Sent bytes aren't parsed unless metrics using them are configured.
+	malformedOtherPath := strings.Replace(exampleClbHttpEntry, `0 29 "GET http://www.example.com:80/ `, `0 garbage "GET http://www.example.com:80/other `, 1)
+	if _, err := reader.ReadClb(strings.NewReader(exampleClbHttpEntry + "\n" + malformedOtherPath)); err != nil {
+		t.Errorf("ReadClb() error = %v for field of metrics not configured", err)
+	}
+	reader = NewLogFileReader(&Config{TargetPaths: []string{"/"}, SentBytesMetricName: "sent_bytes"})
+	if _, err := reader.ReadClb(strings.NewReader(exampleClbHttpEntry + "\n" + malformedOtherPath)); err == nil {
+		t.Error("ReadClb() error = nil for malformed line of other path")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// this is CLB's access log record: https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html
+var (
+	exampleClbHttpEntry = `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -`
+	exampleClbTcpEntry  = `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.001069 0.000028 0.000041 - - 82 305 "- - - " "-" - -`
+	exampleClbNoBackend = `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 - -1 -1 -1 503 0 0 0 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -`
+)
+
+func Test_parseClbLog(t *testing.T) {
+	ts := time.Date(2015, 5, 13, 23, 39, 43, 945958000, time.UTC)
+	tests := []struct {
+		name    string
+		line    string
+		want    *ClbLogRecord
+		wantErr bool
+	}{
+		{
+			name: "Example HTTP entry of document",
+			line: exampleClbHttpEntry,
+			want: &ClbLogRecord{
+				Time:                   ts,
+				Elb:                    "my-loadbalancer",
+				ClientPort:             "192.168.131.39:2817",
+				BackendPort:            "10.0.0.1:80",
+				RequestProcessingTime:  0.000073,
+				BackendProcessingTime:  0.001048,
+				ResponseProcessingTime: 0.000057,
+				ElbStatusCode:          "200",
+				BackendStatusCode:      "200",
+				ReceivedBytes:          0,
+				SentBytes:              29,
+				Request:                "GET http://www.example.com:80/ HTTP/1.1",
+				UserAgent:              "curl/7.38.0",
+				SslCipher:              "-",
+				SslProtocol:            "-",
+				RequestMethod:          "GET",
+				RequestPath:            "/",
+			},
+		},
+		{
+			name: "Example TCP entry of document",
+			line: exampleClbTcpEntry,
+			want: &ClbLogRecord{
+				Time:                   ts,
+				Elb:                    "my-loadbalancer",
+				ClientPort:             "192.168.131.39:2817",
+				BackendPort:            "10.0.0.1:80",
+				RequestProcessingTime:  0.001069,
+				BackendProcessingTime:  0.000028,
+				ResponseProcessingTime: 0.000041,
+				ElbStatusCode:          "-",
+				BackendStatusCode:      "-",
+				ReceivedBytes:          82,
+				SentBytes:              305,
+				Request:                "- - - ",
+				UserAgent:              "-",
+				SslCipher:              "-",
+				SslProtocol:            "-",
+				RequestMethod:          "-",
+				RequestPath:            "",
+			},
+		},
+		{
+			name:    "ALB entry",
+			line:    exampleHttpEntry,
+			wantErr: true,
+		},
+		{
+			name:    "too few fields",
+			line:    strings.TrimSuffix(exampleClbHttpEntry, " - -"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClbLog(tt.line, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseClbLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseClbLog() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
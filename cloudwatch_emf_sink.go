@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+)
+
+const (
+	// defaultCloudWatchEmfNamespace is used when cloudwatch_emf.namespace is not configured.
+	defaultCloudWatchEmfNamespace = "ALB"
+
+	// cloudWatchEmfMaxValues is the max number of values of a metric in a document.
+	cloudWatchEmfMaxValues = 100
+	// cloudWatchEmfMaxDimensions is the max number of dimensions in a dimension set.
+	cloudWatchEmfMaxDimensions = 30
+)
+
+// CloudWatchEmfSink is the Sink printing series as CloudWatch Embedded Metric Format to stdout, which Lambda ships to CloudWatch Logs.
+// see: https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+//
+// A document is printed for each point of series. Values of distribution are aggregated into Values and Counts arrays.
+// When a point has more values or a series has more tags than limits of EMF, it is split into multiple documents.
+type CloudWatchEmfSink struct {
+	namespace string
+	writer    io.Writer
+}
+
+func NewCloudWatchEmfSink(config *Config) (*CloudWatchEmfSink, error) {
+	if err := validateCloudWatchEmfNames(config); err != nil {
+		return nil, err
+	}
+	namespace := config.CloudWatchEmf.Namespace
+	if namespace == "" {
+		namespace = defaultCloudWatchEmfNamespace
+	}
+	return &CloudWatchEmfSink{namespace: namespace, writer: os.Stdout}, nil
+}
+
+// validateCloudWatchEmfNames rejects metric names which are the same as names of tags,
+// because metric values and dimension values are members of the same document and one overwrites the other.
+func validateCloudWatchEmfNames(config *Config) error {
+	tagNames := map[string]bool{"_aws": true}
+	for _, name := range seriesTagNames {
+		tagNames[name] = true
+	}
+	for _, tag := range config.CustomTags {
+		tagNames[tag.Name] = true
+	}
+	for _, name := range config.MetricNames() {
+		if tagNames[name] {
+			return fmt.Errorf("cloudwatch_emf: metric name %q is the same as the name of a tag", name)
+		}
+	}
+	return nil
+}
+
+func (s *CloudWatchEmfSink) Submit(series []Series) error {
+	for _, se := range series {
+		properties := map[string]any{}
+		var dimensions []string
+		for _, tag := range se.Tags {
+			properties[tag.Name] = tag.Value
+			// Dimension value must not be empty.
+			if tag.Value != "" {
+				dimensions = append(dimensions, tag.Name)
+			}
+		}
+		if len(dimensions) == 0 {
+			dimensions = []string{}
+		}
+		metric := cloudWatchEmfMetric{Name: se.Name, Unit: cloudWatchEmfUnit(se.Type, se.Unit)}
+
+		for _, point := range se.Points {
+			var values []any
+			switch se.Type {
+			case SeriesTypeCount:
+				values = []any{point.Value}
+			case SeriesTypeDistribution:
+				values = cloudWatchEmfValues(point.Values)
+			}
+
+			for _, value := range values {
+				for dimensionSet := range slices.Chunk(dimensions, cloudWatchEmfMaxDimensions) {
+					doc := maps.Clone(properties)
+					doc["_aws"] = cloudWatchEmfMetadata{
+						Timestamp: int64(point.Timestamp) * 1000,
+						CloudWatchMetrics: []cloudWatchEmfDirective{{
+							Namespace:  s.namespace,
+							Dimensions: [][]string{dimensionSet},
+							Metrics:    []cloudWatchEmfMetric{metric},
+						}},
+					}
+					doc[se.Name] = value
+					buf, err := json.Marshal(doc)
+					if err != nil {
+						return err
+					}
+					if _, err := s.writer.Write(append(buf, '\n')); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type cloudWatchEmfMetadata struct {
+	Timestamp         int64                    `json:"Timestamp"`
+	CloudWatchMetrics []cloudWatchEmfDirective `json:"CloudWatchMetrics"`
+}
+
+type cloudWatchEmfDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []cloudWatchEmfMetric `json:"Metrics"`
+}
+
+type cloudWatchEmfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit,omitempty"`
+}
+
+type cloudWatchEmfValuesAndCounts struct {
+	Values []float64 `json:"Values"`
+	Counts []float64 `json:"Counts"`
+}
+
+// cloudWatchEmfValues aggregates same values and splits them so that each has at most 100 values.
+func cloudWatchEmfValues(values []float64) []any {
+	counts := map[float64]float64{}
+	for _, v := range values {
+		counts[v]++
+	}
+	distinct := make([]float64, 0, len(counts))
+	for v := range counts {
+		distinct = append(distinct, v)
+	}
+	slices.Sort(distinct)
+
+	var result []any
+	for chunk := range slices.Chunk(distinct, cloudWatchEmfMaxValues) {
+		vc := cloudWatchEmfValuesAndCounts{Values: chunk, Counts: make([]float64, len(chunk))}
+		for i, v := range chunk {
+			vc.Counts[i] = counts[v]
+		}
+		result = append(result, vc)
+	}
+	return result
+}
+
+// cloudWatchEmfUnit returns the unit of CloudWatch.
+// see: https://docs.aws.amazon.com/AmazonCloudWatch/latest/APIReference/API_MetricDatum.html
+func cloudWatchEmfUnit(seriesType SeriesType, unit string) string {
+	switch unit {
+	case "second":
+		return "Seconds"
+	case "byte":
+		return "Bytes"
+	}
+	if seriesType == SeriesTypeCount {
+		return "Count"
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCloudWatchEmfSink_Submit(t *testing.T) {
+	var buf bytes.Buffer
+	sink, err := NewCloudWatchEmfSink(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.writer = &buf
+
+	tags := []SeriesTag{{Name: "elb", Value: "app/my-lb"}, {Name: "path", Value: "/"}, {Name: "target_status_code", Value: ""}}
+	err = sink.Submit([]Series{
+		{
+			Name:   "request_count",
+			Type:   SeriesTypeCount,
+			Unit:   "request",
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1656581400, Value: 3}},
+		},
+		{
+			Name:   "target_processing_time",
+			Type:   SeriesTypeDistribution,
+			Unit:   "second",
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1656581400, Values: []float64{0.5, 0.1, 0.5}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	want := []string{
+		`{"_aws":{"Timestamp":1656581400000,"CloudWatchMetrics":[{"Namespace":"ALB","Dimensions":[["elb","path"]],"Metrics":[{"Name":"request_count","Unit":"Count"}]}]},"elb":"app/my-lb","path":"/","request_count":3,"target_status_code":""}`,
+		`{"_aws":{"Timestamp":1656581400000,"CloudWatchMetrics":[{"Namespace":"ALB","Dimensions":[["elb","path"]],"Metrics":[{"Name":"target_processing_time","Unit":"Seconds"}]}]},"elb":"app/my-lb","path":"/","target_processing_time":{"Values":[0.1,0.5],"Counts":[1,2]},"target_status_code":""}`,
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Submit() prints\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCloudWatchEmfSink_Submit_split(t *testing.T) {
+	var buf bytes.Buffer
+	sink, err := NewCloudWatchEmfSink(&Config{CloudWatchEmf: CloudWatchEmfConfig{Namespace: "MyNamespace"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.writer = &buf
+
+	var tags []SeriesTag
+	for i := range 31 {
+		tags = append(tags, SeriesTag{Name: fmt.Sprintf("tag%02d", i), Value: "v"})
+	}
+	var values []float64
+	for i := range 150 {
+		values = append(values, float64(i))
+	}
+	err = sink.Submit([]Series{{
+		Name:   "target_processing_time",
+		Type:   SeriesTypeDistribution,
+		Unit:   "second",
+		Tags:   tags,
+		Points: []SeriesPoint{{Timestamp: 1, Values: values}},
+	}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	type document struct {
+		Aws                  cloudWatchEmfMetadata        `json:"_aws"`
+		TargetProcessingTime cloudWatchEmfValuesAndCounts `json:"target_processing_time"`
+	}
+	var docs []document
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var doc document
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+
+	// 2 chunks of values * 2 chunks of dimensions
+	if len(docs) != 4 {
+		t.Fatalf("got %d documents, want 4", len(docs))
+	}
+	var gotValues, gotDimensions []int
+	for _, doc := range docs {
+		directive := doc.Aws.CloudWatchMetrics[0]
+		if directive.Namespace != "MyNamespace" {
+			t.Errorf("Namespace = %s, want MyNamespace", directive.Namespace)
+		}
+		gotValues = append(gotValues, len(doc.TargetProcessingTime.Values))
+		gotDimensions = append(gotDimensions, len(directive.Dimensions[0]))
+	}
+	if want := []int{100, 100, 50, 50}; !reflect.DeepEqual(gotValues, want) {
+		t.Errorf("number of values = %v, want %v", gotValues, want)
+	}
+	if want := []int{30, 1, 30, 1}; !reflect.DeepEqual(gotDimensions, want) {
+		t.Errorf("number of dimensions = %v, want %v", gotDimensions, want)
+	}
+}
+
+func TestNewCloudWatchEmfSink_names(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{name: "valid", config: &Config{RequestCountMetricName: "request_count", CustomTags: []Tag{{Name: "env"}}}},
+		{name: "same as built-in tag", config: &Config{RequestCountMetricName: "path"}, wantErr: true},
+		{name: "same as custom tag", config: &Config{Nlb: NlbConfig{ConnectionCountMetricName: "env"}, CustomTags: []Tag{{Name: "env"}}}, wantErr: true},
+		{name: "same as metadata", config: &Config{MalformedLines: MalformedLinesConfig{MetricsName: "_aws"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCloudWatchEmfSink(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("NewCloudWatchEmfSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
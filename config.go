@@ -1,16 +1,45 @@
 package main
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
+	"regexp"
+	"slices"
+	"time"
 )
 
 type Config struct {
-	RequestCountMetricName         string                 `yaml:"request_count_metrics_name"`
-	TargetProcessingTimeMetricName string                 `yaml:"target_processing_time_metrics_name"`
-	PathTransformingRules          []PathTransformingRule `yaml:"path_transforming_rules"`
-	TargetPaths                    []string               `yaml:"target_paths"`
-	CustomTags                     []Tag                  `yaml:"custom_tags"`
+	RequestCountMetricName         string `yaml:"request_count_metrics_name"`
+	TargetProcessingTimeMetricName string `yaml:"target_processing_time_metrics_name"`
+	// RequestProcessingTimeMetricName, ResponseProcessingTimeMetricName and TotalLatencyMetricName are optional, and submitted only when configured.
+	RequestProcessingTimeMetricName  string `yaml:"request_processing_time_metrics_name"`
+	ResponseProcessingTimeMetricName string `yaml:"response_processing_time_metrics_name"`
+	TotalLatencyMetricName           string `yaml:"total_latency_metrics_name"`
+	// ReceivedBytesMetricName and SentBytesMetricName are total bytes, and RequestSizeMetricName and ResponseSizeMetricName are distributions of bytes of each request.
+	// They are optional, and submitted only when configured.
+	ReceivedBytesMetricName string `yaml:"received_bytes_metrics_name"`
+	SentBytesMetricName     string `yaml:"sent_bytes_metrics_name"`
+	RequestSizeMetricName   string `yaml:"request_size_metrics_name"`
+	ResponseSizeMetricName  string `yaml:"response_size_metrics_name"`
+	// NoTargetResponseCountMetricName is optional, and the number of requests whose target processing time is -1 is submitted only when configured.
+	NoTargetResponseCountMetricName string                     `yaml:"no_target_response_count_metrics_name"`
+	PathTransformingRules           PathTransformingRules      `yaml:"path_transforming_rules"`
+	TargetPaths                     []string                   `yaml:"target_paths"`
+	CustomTags                      []Tag                      `yaml:"custom_tags"`
+	MaxSeriesPerRequest             int                        `yaml:"max_series_per_request"`
+	SubmitRetry                     RetryConfig                `yaml:"submit_retry"`
+	SubmitConcurrency               int                        `yaml:"submit_concurrency"`
+	Sinks                           []string                   `yaml:"sinks"`
+	ProcessedObjectStore            ProcessedObjectStoreConfig `yaml:"processed_object_store"`
+	MalformedLines                  MalformedLinesConfig       `yaml:"malformed_lines"`
+	Nlb                             NlbConfig                  `yaml:"nlb"`
+	AlbConnection                   AlbConnectionConfig        `yaml:"alb_connection"`
+
+	PrometheusRemoteWrite PrometheusRemoteWriteConfig `yaml:"prometheus_remote_write"`
+	Otlp                  OtlpConfig                  `yaml:"otlp"`
+	DogStatsD             DogStatsDConfig             `yaml:"dogstatsd"`
+	CloudWatchEmf         CloudWatchEmfConfig         `yaml:"cloudwatch_emf"`
 }
 
 type Tag struct {
@@ -18,10 +47,140 @@ type Tag struct {
 	EnvKey string `yaml:"env_key"`
 }
 
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+type PrometheusRemoteWriteConfig struct {
+	Endpoint            string            `yaml:"endpoint"`
+	BasicAuth           *BasicAuthConfig  `yaml:"basic_auth"`
+	BearerTokenEnvKey   string            `yaml:"bearer_token_env_key"`
+	Headers             map[string]string `yaml:"headers"`
+	Buckets             []float64         `yaml:"buckets"`
+	MaxSeriesPerRequest int               `yaml:"max_series_per_request"`
+	Timeout             time.Duration     `yaml:"timeout"`
+}
+
+type OtlpConfig struct {
+	Endpoint            string            `yaml:"endpoint"`
+	Encoding            string            `yaml:"encoding"`
+	Compression         string            `yaml:"compression"`
+	Headers             map[string]string `yaml:"headers"`
+	MaxBuckets          int               `yaml:"max_buckets"`
+	MaxSeriesPerRequest int               `yaml:"max_series_per_request"`
+	Timeout             time.Duration     `yaml:"timeout"`
+}
+
+type DogStatsDConfig struct {
+	Url           string `yaml:"url"`
+	MaxPacketSize int    `yaml:"max_packet_size"`
+}
+
+type MalformedLinesConfig struct {
+	Policy      string  `yaml:"policy"`
+	MaxCount    int     `yaml:"max_count"`
+	MaxPercent  float64 `yaml:"max_percent"`
+	MetricsName string  `yaml:"metrics_name"`
+}
+
+func (c *MalformedLinesConfig) Validate() error {
+	switch c.Policy {
+	case "", MalformedLinesPolicyFail, MalformedLinesPolicySkip:
+		return nil
+	}
+	return fmt.Errorf("malformed_lines.policy must be %s or %s: %s", MalformedLinesPolicyFail, MalformedLinesPolicySkip, c.Policy)
+}
+
+// NlbConfig is metric names of NLB log files. Metrics whose name is empty are not submitted.
+type NlbConfig struct {
+	ConnectionCountMetricName  string `yaml:"connection_count_metrics_name"`
+	TlsHandshakeTimeMetricName string `yaml:"tls_handshake_time_metrics_name"`
+	ReceivedBytesMetricName    string `yaml:"received_bytes_metrics_name"`
+	SentBytesMetricName        string `yaml:"sent_bytes_metrics_name"`
+}
+
+// AlbConnectionConfig is metric names of ALB connection log files. Metrics whose name is empty are not submitted.
+type AlbConnectionConfig struct {
+	ConnectionCountMetricName     string `yaml:"connection_count_metrics_name"`
+	TlsHandshakeLatencyMetricName string `yaml:"tls_handshake_latency_metrics_name"`
+}
+
+type ProcessedObjectStoreConfig struct {
+	Type      string        `yaml:"type"`
+	TableName string        `yaml:"table_name"`
+	Ttl       time.Duration `yaml:"ttl"`
+	Lease     time.Duration `yaml:"lease"`
+}
+
+type CloudWatchEmfConfig struct {
+	Namespace string `yaml:"namespace"`
+}
+
+type BasicAuthConfig struct {
+	Username       string `yaml:"username"`
+	PasswordEnvKey string `yaml:"password_env_key"`
+}
+
+// PathTransformingRules is the list of PathTransformingRule decoded from YAML.
+type PathTransformingRules []PathTransformingRule
+
+// UnmarshalYAML decodes rules and compiles `regexp` of them.
+// The error tells the index of the invalid rule so that it can be found in long list of rules.
+func (rules *PathTransformingRules) UnmarshalYAML(value *yaml.Node) error {
+	var raws []struct {
+		Prefix      string `yaml:"prefix"`
+		Suffix      string `yaml:"suffix"`
+		Regexp      string `yaml:"regexp"`
+		Transformed string `yaml:"transformed"`
+	}
+	if err := value.Decode(&raws); err != nil {
+		return err
+	}
+
+	result := make(PathTransformingRules, 0, len(raws))
+	for i, raw := range raws {
+		line := value.Content[i].Line
+		rule := PathTransformingRule{Prefix: raw.Prefix, Suffix: raw.Suffix, Transformed: raw.Transformed}
+		if raw.Regexp != "" {
+			re, err := regexp.Compile(raw.Regexp)
+			if err != nil {
+				return fmt.Errorf("path_transforming_rules[%d] (line %d): invalid regexp %q: %w", i, line, raw.Regexp, err)
+			}
+			rule.Regexp = re
+		}
+		if raw.Prefix == "" && raw.Suffix == "" && raw.Regexp == "" {
+			return fmt.Errorf("path_transforming_rules[%d] (line %d): one of prefix, suffix and regexp is required", i, line)
+		}
+		result = append(result, rule)
+	}
+	*rules = result
+	return nil
+}
+
+// MetricNames returns names of metrics which are configured to be submitted.
+func (c *Config) MetricNames() []string {
+	names := []string{
+		c.RequestCountMetricName, c.TargetProcessingTimeMetricName,
+		c.RequestProcessingTimeMetricName, c.ResponseProcessingTimeMetricName, c.TotalLatencyMetricName,
+		c.ReceivedBytesMetricName, c.SentBytesMetricName, c.RequestSizeMetricName, c.ResponseSizeMetricName,
+		c.NoTargetResponseCountMetricName, c.MalformedLines.MetricsName,
+		c.Nlb.ConnectionCountMetricName, c.Nlb.TlsHandshakeTimeMetricName, c.Nlb.ReceivedBytesMetricName, c.Nlb.SentBytesMetricName,
+		c.AlbConnection.ConnectionCountMetricName, c.AlbConnection.TlsHandshakeLatencyMetricName,
+	}
+	return slices.DeleteFunc(names, func(name string) bool { return name == "" })
+}
+
 func (t *Tag) Key() string {
 	return os.Getenv(t.EnvKey)
 }
 
+// NewConfigFromEnv reads the config file of CONFIG_PATH.
+func NewConfigFromEnv() (*Config, error) {
+	return NewConfigFromFile(os.Getenv("CONFIG_PATH"))
+}
+
 func NewConfigFromFile(path string) (*Config, error) {
 	var config Config
 	buf, err := os.ReadFile(path)
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestPathTransformingRules_UnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "rules",
+			yaml: `
+- prefix: /api/v1/hoge
+  transformed: /api/v1/hoge
+- regexp: ^/api/v1/users/(?P<user>[^/]+)/items$
+  transformed: /api/v1/users/$user/items
+`,
+			want: []string{"", `^/api/v1/users/(?P<user>[^/]+)/items$`},
+		},
+		{
+			name: "invalid regexp",
+			yaml: `
+- prefix: /api/v1/hoge
+  transformed: /api/v1/hoge
+- regexp: /api/v1/(hoge
+  transformed: /api/v1/hoge
+`,
+			wantErr: "path_transforming_rules[1] (line 4): invalid regexp \"/api/v1/(hoge\"",
+		},
+		{
+			name: "no condition",
+			yaml: `
+- transformed: /api/v1/hoge
+`,
+			wantErr: "path_transforming_rules[0] (line 2): one of prefix, suffix and regexp is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules PathTransformingRules
+			err := yaml.Unmarshal([]byte(tt.yaml), &rules)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("UnmarshalYAML() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalYAML() error = %v", err)
+			}
+			if len(rules) != len(tt.want) {
+				t.Fatalf("UnmarshalYAML() = %d rules, want %d", len(rules), len(tt.want))
+			}
+			for i, rule := range rules {
+				got := ""
+				if rule.Regexp != nil {
+					got = rule.Regexp.String()
+				}
+				if got != tt.want[i] {
+					t.Errorf("rules[%d].Regexp = %s, want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultDogStatsDUrl is the address of DogStatsD served by Datadog Lambda Extension.
+	defaultDogStatsDUrl = "udp://127.0.0.1:8125"
+	// defaultDogStatsDUdpPacketSize fits in an Ethernet frame without fragmentation.
+	// see: https://docs.datadoghq.com/developers/dogstatsd/high_throughput/#ensure-proper-packet-sizes
+	defaultDogStatsDUdpPacketSize = 1432
+	// defaultDogStatsDUdsPacketSize is the default buffer size of DogStatsD for Unix domain socket.
+	defaultDogStatsDUdsPacketSize = 8192
+)
+
+// DogStatsDSink is the Sink sending series to DogStatsD over UDP or Unix domain socket.
+// Each point is sent with its timestamp using the timestamp field of DogStatsD protocol v1.3.
+// see: https://docs.datadoghq.com/developers/dogstatsd/datagram_shell/
+//
+// Note that Datadog Agent may ignore timestamp of distribution metrics, which is supported by count and gauge metrics only.
+type DogStatsDSink struct {
+	network       string
+	address       string
+	maxPacketSize int
+}
+
+func NewDogStatsDSink(config *Config) (*DogStatsDSink, error) {
+	c := config.DogStatsD
+	rawUrl := c.Url
+	if rawUrl == "" {
+		rawUrl = os.Getenv("DD_DOGSTATSD_URL")
+	}
+	if rawUrl == "" {
+		rawUrl = defaultDogStatsDUrl
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dogstatsd.url: %w", err)
+	}
+
+	s := &DogStatsDSink{maxPacketSize: c.MaxPacketSize}
+	switch u.Scheme {
+	case "udp":
+		s.network, s.address = "udp", u.Host
+		if s.maxPacketSize == 0 {
+			s.maxPacketSize = defaultDogStatsDUdpPacketSize
+		}
+	case "unix":
+		s.network, s.address = "unixgram", u.Path
+		if s.maxPacketSize == 0 {
+			s.maxPacketSize = defaultDogStatsDUdsPacketSize
+		}
+	default:
+		return nil, fmt.Errorf("dogstatsd.url must be udp://host:port or unix:///path: %s", rawUrl)
+	}
+	return s, nil
+}
+
+func (s *DogStatsDSink) Submit(series []Series) error {
+	conn, err := net.Dial(s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to DogStatsD: %w", err)
+	}
+	defer conn.Close()
+
+	b := &dogStatsDBuffer{conn: conn, maxPacketSize: s.maxPacketSize}
+	for _, se := range series {
+		name := dogStatsDEscape(se.Name)
+		tags := make([]string, len(se.Tags))
+		for i, tag := range se.Tags {
+			tags[i] = dogStatsDEscape(tag.String())
+		}
+
+		for _, point := range se.Points {
+			switch se.Type {
+			case SeriesTypeCount:
+				suffix := dogStatsDSuffix("c", tags, point.Timestamp)
+				if err := b.write(name + ":" + formatDogStatsDValue(point.Value) + suffix); err != nil {
+					return err
+				}
+			case SeriesTypeDistribution:
+				// Multiple values of a distribution are packed into one message unless exceeding max packet size.
+				suffix := dogStatsDSuffix("d", tags, point.Timestamp)
+				var message strings.Builder
+				for _, v := range point.Values {
+					value := ":" + formatDogStatsDValue(v)
+					if message.Len() > 0 && message.Len()+len(value)+len(suffix) > s.maxPacketSize {
+						if err := b.write(message.String() + suffix); err != nil {
+							return err
+						}
+						message.Reset()
+					}
+					if message.Len() == 0 {
+						message.WriteString(name)
+					}
+					message.WriteString(value)
+				}
+				if message.Len() > 0 {
+					if err := b.write(message.String() + suffix); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return b.flush()
+}
+
+// dogStatsDBuffer packs messages separated by newline into packets up to max packet size.
+type dogStatsDBuffer struct {
+	conn          net.Conn
+	maxPacketSize int
+	buf           []byte
+}
+
+func (b *dogStatsDBuffer) write(message string) error {
+	if len(message) > b.maxPacketSize {
+		return fmt.Errorf("DogStatsD message is larger than max packet size %d: %s", b.maxPacketSize, message)
+	}
+	if len(b.buf) > 0 && len(b.buf)+1+len(message) > b.maxPacketSize {
+		if err := b.flush(); err != nil {
+			return err
+		}
+	}
+	if len(b.buf) > 0 {
+		b.buf = append(b.buf, '\n')
+	}
+	b.buf = append(b.buf, message...)
+	return nil
+}
+
+func (b *dogStatsDBuffer) flush() error {
+	if len(b.buf) == 0 {
+		return nil
+	}
+	_, err := b.conn.Write(b.buf)
+	b.buf = b.buf[:0]
+	if err != nil {
+		return fmt.Errorf("failed to send to DogStatsD: %w", err)
+	}
+	return nil
+}
+
+func dogStatsDSuffix(metricType string, tags []string, timestamp Timestamp) string {
+	suffix := "|" + metricType
+	if len(tags) > 0 {
+		suffix += "|#" + strings.Join(tags, ",")
+	}
+	return suffix + "|T" + strconv.FormatInt(int64(timestamp), 10)
+}
+
+func formatDogStatsDValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// dogStatsDEscape replaces characters used as separators of DogStatsD protocol.
+var dogStatsDEscape = strings.NewReplacer("|", "_", ",", "_", "\n", "_").Replace
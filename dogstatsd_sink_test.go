@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDogStatsDSink_Submit(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	const maxPacketSize = 90
+	sink, err := NewDogStatsDSink(&Config{
+		DogStatsD: DogStatsDConfig{Url: "udp://" + conn.LocalAddr().String(), MaxPacketSize: maxPacketSize},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := []SeriesTag{{Name: "elb", Value: "app/my-lb"}, {Name: "path", Value: "/a,b"}}
+	err = sink.Submit([]Series{
+		{
+			Name:   "request_count",
+			Type:   SeriesTypeCount,
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1656581400, Value: 3}, {Timestamp: 1656581401, Value: 1}},
+		},
+		{
+			Name:   "target_processing_time",
+			Type:   SeriesTypeDistribution,
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1656581400, Values: []float64{0.001, 0.25, 1.5, 10, 0.001, 0.25, 1.5, 10}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	var got []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > maxPacketSize {
+			t.Errorf("packet size is %d, larger than %d", n, maxPacketSize)
+		}
+		got = append(got, strings.Split(string(buf[:n]), "\n")...)
+	}
+
+	want := []string{
+		"request_count:3|c|#elb:app/my-lb,path:/a_b|T1656581400",
+		"request_count:1|c|#elb:app/my-lb,path:/a_b|T1656581401",
+		"target_processing_time:0.001:0.25:1.5:10:0.001:0.25|d|#elb:app/my-lb,path:/a_b|T1656581400",
+		"target_processing_time:1.5:10|d|#elb:app/my-lb,path:/a_b|T1656581400",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Submit() sends %q, want %q", got, want)
+	}
+}
+
+func TestNewDogStatsDSink(t *testing.T) {
+	tests := []struct {
+		name              string
+		url               string
+		wantNetwork       string
+		wantAddress       string
+		wantMaxPacketSize int
+		wantErr           bool
+	}{
+		{name: "default", url: "", wantNetwork: "udp", wantAddress: "127.0.0.1:8125", wantMaxPacketSize: 1432},
+		{name: "unix domain socket", url: "unix:///var/run/datadog/dsd.socket", wantNetwork: "unixgram", wantAddress: "/var/run/datadog/dsd.socket", wantMaxPacketSize: 8192},
+		{name: "unknown scheme", url: "tcp://127.0.0.1:8125", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DD_DOGSTATSD_URL", "")
+			got, err := NewDogStatsDSink(&Config{DogStatsD: DogStatsDConfig{Url: tt.url}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDogStatsDSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.network != tt.wantNetwork || got.address != tt.wantAddress || got.maxPacketSize != tt.wantMaxPacketSize {
+				t.Errorf("NewDogStatsDSink() = %+v", got)
+			}
+		})
+	}
+}
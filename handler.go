@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ObjectGetter gets log files from S3. It is implemented by *s3.Client.
+type ObjectGetter interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// EventHandler processes log files notified by events of Lambda.
+type EventHandler struct {
+	Processor *Processor
+	S3        ObjectGetter
+	// ProcessedObjects is consulted to skip log files already processed or being processed by others, and is optional.
+	ProcessedObjects ProcessedObjectStore
+
+	// markRetrier retries marking log files as processed, which is replaceable for testing.
+	markRetrier *Retrier
+}
+
+// markProcessedRetry is short enough to finish within the timeout of Lambda after submission.
+var markProcessedRetry = RetryConfig{MaxAttempts: 3, InitialBackoff: 200 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+// S3Object is the log file notified by an event.
+type S3Object struct {
+	Bucket string
+	Key    string
+	// Size is nil when the event doesn't tell it, e.g. manual invocations.
+	Size *int64
+	ETag string
+}
+
+// Handle processes S3 event, EventBridge "Object Created" event of S3, or SQS event whose messages are one of them.
+// For SQS event, failed messages are returned as BatchItemFailures of events.SQSEventResponse so that only they are retried.
+func (h *EventHandler) Handle(ctx context.Context, payload json.RawMessage) (any, error) {
+	var event struct {
+		Records []struct {
+			EventSource string `json:"eventSource"`
+		} `json:"Records"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+
+	if len(event.Records) > 0 && event.Records[0].EventSource == "aws:sqs" {
+		var sqsEvent events.SQSEvent
+		if err := json.Unmarshal(payload, &sqsEvent); err != nil {
+			return nil, fmt.Errorf("failed to parse SQS event: %w", err)
+		}
+		return h.handleSQSEvent(ctx, sqsEvent), nil
+	}
+
+	objects, err := s3ObjectsFromEvent(payload)
+	if err != nil {
+		return nil, err
+	}
+	logMetrics, claimed, err := h.readObjects(ctx, objects, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	if err := h.submit(logMetrics); err != nil {
+		h.release(ctx, claimed)
+		return nil, err
+	}
+	h.markProcessed(ctx, claimed)
+	return nil, nil
+}
+
+// handleSQSEvent reads log files of all messages and submits metrics merged across them at once.
+// Messages whose log files can't be read are reported as failures, and all of other messages are also failures when submission fails.
+func (h *EventHandler) handleSQSEvent(ctx context.Context, sqsEvent events.SQSEvent) events.SQSEventResponse {
+	response := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+	merged := NewLogMetrics()
+	var succeeded []string
+	claimed := map[string][]S3Object{}
+	seen := map[string]bool{}
+	for _, message := range sqsEvent.Records {
+		objects, err := s3ObjectsFromSQSMessage(message.Body)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to process SQS message %s: %s\n", message.MessageId, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+			continue
+		}
+		logMetrics, messageClaimed, err := h.readObjects(ctx, objects, seen)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to process SQS message %s: %s\n", message.MessageId, err)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+			continue
+		}
+		merged.Merge(logMetrics)
+		succeeded = append(succeeded, message.MessageId)
+		claimed[message.MessageId] = messageClaimed
+	}
+
+	if err := h.submit(merged); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to submit metrics of %d SQS messages: %s\n", len(succeeded), err)
+		for _, id := range succeeded {
+			h.release(ctx, claimed[id])
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: id})
+		}
+		return response
+	}
+	for _, id := range succeeded {
+		h.markProcessed(ctx, claimed[id])
+	}
+	return response
+}
+
+// s3ObjectsFromSQSMessage parses body of SQS message as the event notifying objects.
+// The event is wrapped by SNS notification when the queue subscribes SNS topic without raw message delivery.
+func s3ObjectsFromSQSMessage(body string) ([]S3Object, error) {
+	var snsEntity struct {
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+	if err := json.Unmarshal([]byte(body), &snsEntity); err == nil && snsEntity.Type == "Notification" {
+		body = snsEntity.Message
+	}
+	return s3ObjectsFromEvent([]byte(body))
+}
+
+// s3ObjectsFromEvent parses S3 event notification or EventBridge "Object Created" event of S3.
+// Note that test event sent by S3 on configuring notification has no records.
+// see: https://docs.aws.amazon.com/AmazonS3/latest/userguide/ev-events.html
+func s3ObjectsFromEvent(payload []byte) ([]S3Object, error) {
+	var eventBridgeEvent events.EventBridgeEvent
+	if err := json.Unmarshal(payload, &eventBridgeEvent); err == nil && eventBridgeEvent.Source == "aws.s3" {
+		if eventBridgeEvent.DetailType != "Object Created" {
+			return nil, fmt.Errorf("unsupported EventBridge event of S3: %s", eventBridgeEvent.DetailType)
+		}
+		var detail struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size *int64 `json:"size"`
+				ETag string `json:"etag"`
+			} `json:"object"`
+		}
+		if err := json.Unmarshal(eventBridgeEvent.Detail, &detail); err != nil {
+			return nil, fmt.Errorf("failed to parse EventBridge event of S3: %w", err)
+		}
+		return []S3Object{{Bucket: detail.Bucket.Name, Key: detail.Object.Key, Size: detail.Object.Size, ETag: detail.Object.ETag}}, nil
+	}
+
+	// Size of events.S3Event can't tell whether it is missing, so records are parsed with fields used here only.
+	var s3Event struct {
+		Records []struct {
+			S3 struct {
+				Bucket struct {
+					Name string `json:"name"`
+				} `json:"bucket"`
+				Object struct {
+					Key  string `json:"key"`
+					Size *int64 `json:"size"`
+					ETag string `json:"eTag"`
+				} `json:"object"`
+			} `json:"s3"`
+		} `json:"Records"`
+	}
+	if err := json.Unmarshal(payload, &s3Event); err != nil {
+		return nil, fmt.Errorf("failed to parse S3 event notification: %w", err)
+	}
+	objects := make([]S3Object, 0, len(s3Event.Records))
+	for _, record := range s3Event.Records {
+		objects = append(objects, S3Object{Bucket: record.S3.Bucket.Name, Key: record.S3.Object.Key, Size: record.S3.Object.Size, ETag: record.S3.Object.ETag})
+	}
+	return objects, nil
+}
+
+// readObjects reads log files and merges their metrics, so that metrics of the same minute written by multiple nodes are submitted at once.
+// Log files are claimed before read, and ones already processed or being processed by others are skipped.
+// Claimed log files are returned to be marked as processed after submission, and their claims are released when reading fails.
+// Without ProcessedObjects, log files notified multiple times in an invocation are read once by recording them in seen.
+func (h *EventHandler) readObjects(ctx context.Context, objects []S3Object, seen map[string]bool) (*LogMetrics, []S3Object, error) {
+	merged := NewLogMetrics()
+	var claimed []S3Object
+	for _, object := range objects {
+		fmt.Fprintf(os.Stderr, "%+v\n", object)
+		if h.ProcessedObjects == nil {
+			id := processedObjectId(object)
+			if seen[id] {
+				fmt.Fprintf(os.Stderr, "skip duplicated object: s3://%s/%s\n", object.Bucket, object.Key)
+				continue
+			}
+			seen[id] = true
+		} else {
+			err := h.ProcessedObjects.Claim(ctx, object)
+			if errors.Is(err, ErrAlreadyProcessed) {
+				fmt.Fprintf(os.Stderr, "skip already processed object: s3://%s/%s\n", object.Bucket, object.Key)
+				continue
+			}
+			if err != nil {
+				h.release(ctx, claimed)
+				return nil, nil, err
+			}
+			claimed = append(claimed, object)
+		}
+		logMetrics, err := h.readObject(ctx, object)
+		if err != nil {
+			h.release(ctx, claimed)
+			return nil, nil, err
+		}
+		merged.Merge(logMetrics)
+	}
+	return merged, claimed, nil
+}
+
+// readObject downloads and reads a log file. Objects known to be empty have no records, so they are skipped without download.
+func (h *EventHandler) readObject(ctx context.Context, object S3Object) (*LogMetrics, error) {
+	if object.Size != nil && *object.Size == 0 {
+		fmt.Fprintf(os.Stderr, "skip empty object: s3://%s/%s\n", object.Bucket, object.Key)
+		return NewLogMetrics(), nil
+	}
+	obj, err := h.S3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &object.Bucket,
+		Key:    &object.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+
+	fmt.Fprintln(os.Stderr, "finish download from s3")
+
+	logMetrics, err := h.Processor.ReadLogfile(obj.Body, object.Key)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr, "finish processLogFile")
+	return logMetrics, nil
+}
+
+// submit submits metrics unless there is nothing to submit, e.g. for test event of S3.
+func (h *EventHandler) submit(logMetrics *LogMetrics) error {
+	if logMetrics.IsEmpty() {
+		return nil
+	}
+	return h.Processor.Submit(logMetrics)
+}
+
+// markProcessed marks claimed log files as processed after their metrics have been submitted, retrying failures with backoff.
+// Failures are only logged rather than failing the invocation, because retries and redeliveries would submit the metrics again
+// once the claim has expired. The claim is kept until its lease expires, so that retries don't submit the metrics meanwhile.
+func (h *EventHandler) markProcessed(ctx context.Context, objects []S3Object) {
+	if h.ProcessedObjects == nil {
+		return
+	}
+	retrier := h.markRetrier
+	if retrier == nil {
+		retrier = NewRetrier(markProcessedRetry)
+	}
+	for _, object := range objects {
+		err := retrier.Do(ctx, "MarkProcessed", func() (*http.Response, error) {
+			return nil, h.ProcessedObjects.MarkProcessed(ctx, object)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to mark s3://%s/%s as processed: %s\n", object.Bucket, object.Key, err)
+		}
+	}
+}
+
+// release releases claims of log files whose metrics haven't been submitted, so that they are processed again by retries.
+// Failures are only logged, because the claim can be taken over after its lease anyway.
+func (h *EventHandler) release(ctx context.Context, objects []S3Object) {
+	if h.ProcessedObjects == nil {
+		return
+	}
+	for _, object := range objects {
+		if err := h.ProcessedObjects.Release(ctx, object); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to release s3://%s/%s: %s\n", object.Bucket, object.Key, err)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeObjectGetter is the ObjectGetter returning objects in memory keyed by `bucket/key`.
+type fakeObjectGetter map[string][]byte
+
+func (g fakeObjectGetter) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := g[*params.Bucket+"/"+*params.Key]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s/%s", *params.Bucket, *params.Key)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func newTestEventHandler(t *testing.T, sink Sink) *EventHandler {
+	t.Helper()
+	processor, _ := newTestProcessor(&Config{
+		RequestCountMetricName:         "request_count",
+		TargetProcessingTimeMetricName: "target_processing_time",
+		TargetPaths:                    []string{"/"},
+	})
+	processor.Sink = sink
+	return &EventHandler{
+		Processor: processor,
+		S3: fakeObjectGetter{
+			"my-bucket/" + exampleLogObjectKey:        gzipBytes(t, exampleHttpEntry+"\n").Bytes(),
+			"my-bucket/" + exampleAnotherLogObjectKey: gzipBytes(t, exampleHttpEntry+"\n").Bytes(),
+		},
+	}
+}
+
+// exampleEventBridgeObjectCreatedEvent is the sample of EventBridge "Object Created" event of S3.
+// see: https://docs.aws.amazon.com/AmazonS3/latest/userguide/ev-events.html
+const exampleEventBridgeObjectCreatedEvent = `{
+  "version": "0",
+  "id": "17793124-05d4-b198-2fde-7ededc63b103",
+  "detail-type": "Object Created",
+  "source": "aws.s3",
+  "account": "123456789012",
+  "time": "2018-07-02T22:25:00Z",
+  "region": "us-east-2",
+  "resources": ["arn:aws:s3:::my-bucket"],
+  "detail": {
+    "version": "0",
+    "bucket": {"name": "my-bucket"},
+    "object": {
+      "key": "` + exampleLogObjectKey + `",
+      "size": 1024,
+      "etag": "b1946ac92492d2347c6235b4d2611184",
+      "version-id": "IYV3p45BT0ac8hjHg1houSdS1a.Mro8e",
+      "sequencer": "617f08299329d189"
+    },
+    "request-id": "N4N7GDK58NMKJ12R",
+    "requester": "123456789012",
+    "source-ip-address": "1.2.3.4",
+    "reason": "PutObject"
+  }
+}`
+
+// exampleS3Event is the sample of S3 event notification.
+// see: https://docs.aws.amazon.com/AmazonS3/latest/userguide/notification-content-structure.html
+const exampleS3Event = `{
+  "Records": [
+    {
+      "eventVersion": "2.1",
+      "eventSource": "aws:s3",
+      "awsRegion": "us-east-2",
+      "eventTime": "2018-07-02T22:25:00.000Z",
+      "eventName": "ObjectCreated:Put",
+      "userIdentity": {"principalId": "AWS:AIDAJDPLRKLG7UEXAMPLE"},
+      "requestParameters": {"sourceIPAddress": "1.2.3.4"},
+      "responseElements": {"x-amz-request-id": "C3D13FE58DE4C810", "x-amz-id-2": "FMyUVURIY8/IgAtTv8xRjskZQpcIZ9KG4V5Wp6S7S/JRWeUWerMUE5JgHvANOjpD"},
+      "s3": {
+        "s3SchemaVersion": "1.0",
+        "configurationId": "alb-logs",
+        "bucket": {"name": "my-bucket", "ownerIdentity": {"principalId": "A3NL1KOZZKExample"}, "arn": "arn:aws:s3:::my-bucket"},
+        "object": {"key": "` + exampleLogObjectKey + `", "size": 1024, "eTag": "d41d8cd98f00b204e9800998ecf8427e", "sequencer": "0055AED6DCD90281E5"}
+      }
+    }
+  ]
+}`
+
+func Test_s3ObjectsFromEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    []S3Object
+		wantErr bool
+	}{
+		{
+			name:    "S3 event",
+			payload: exampleS3Event,
+			want:    []S3Object{{Bucket: "my-bucket", Key: exampleLogObjectKey, Size: aws.Int64(1024), ETag: "d41d8cd98f00b204e9800998ecf8427e"}},
+		},
+		{
+			name:    "EventBridge event",
+			payload: exampleEventBridgeObjectCreatedEvent,
+			want:    []S3Object{{Bucket: "my-bucket", Key: exampleLogObjectKey, Size: aws.Int64(1024), ETag: "b1946ac92492d2347c6235b4d2611184"}},
+		},
+		{
+			name:    "EventBridge event other than Object Created",
+			payload: strings.Replace(exampleEventBridgeObjectCreatedEvent, "Object Created", "Object Deleted", 1),
+			wantErr: true,
+		},
+		{
+			name:    "S3 test event",
+			payload: `{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2018-07-02T22:25:00.000Z","Bucket":"my-bucket","RequestId":"5582815E1AEA5ADF","HostId":"8cLeGAmw098X5cv4Zkwcmo8vvZa3eH3eKxsPzbB9wrR+YstdA6Knx4Ip8EXAMPLE"}`,
+			want:    []S3Object{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s3ObjectsFromEvent([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("s3ObjectsFromEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("s3ObjectsFromEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func s3EventJson(bucket string, keys ...string) string {
+	records := make([]string, len(keys))
+	for i, key := range keys {
+		records[i] = fmt.Sprintf(`{"eventVersion":"2.1","eventSource":"aws:s3","awsRegion":"us-east-2","eventName":"ObjectCreated:Put","s3":{"bucket":{"name":%q},"object":{"key":%q,"size":1024,"eTag":"b1946ac92492d2347c6235b4d2611184"}}}`, bucket, key)
+	}
+	return `{"Records":[` + strings.Join(records, ",") + `]}`
+}
+
+func snsNotificationJson(message string) string {
+	buf, _ := json.Marshal(map[string]string{
+		"Type":      "Notification",
+		"MessageId": "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		"TopicArn":  "arn:aws:sns:us-east-2:123456789012:alb-logs",
+		"Message":   message,
+		"Timestamp": "2018-07-02T22:25:00.000Z",
+	})
+	return string(buf)
+}
+
+func sqsEventJson(bodies map[string]string) string {
+	var event events.SQSEvent
+	for id, body := range bodies {
+		event.Records = append(event.Records, events.SQSMessage{MessageId: id, Body: body, EventSource: "aws:sqs"})
+	}
+	buf, _ := json.Marshal(event)
+	return string(buf)
+}
+
+func TestEventHandler_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    any
+		wantErr bool
+		// wantCalls is the number of submissions, and wantCounts is request counts of each IP address.
+		wantCalls  int
+		wantCounts map[string]float64
+	}{
+		{
+			name:       "S3 event",
+			payload:    s3EventJson("my-bucket", exampleLogObjectKey),
+			want:       nil,
+			wantCalls:  1,
+			wantCounts: map[string]float64{"172.160.001.192": 1},
+		},
+		{
+			// The object notified twice is read once.
+			name:       "S3 event with multiple records",
+			payload:    s3EventJson("my-bucket", exampleLogObjectKey, exampleAnotherLogObjectKey, exampleLogObjectKey),
+			want:       nil,
+			wantCalls:  1,
+			wantCounts: map[string]float64{"172.160.001.192": 1, "172.160.001.193": 1},
+		},
+		{
+			name:       "EventBridge event",
+			payload:    exampleEventBridgeObjectCreatedEvent,
+			want:       nil,
+			wantCalls:  1,
+			wantCounts: map[string]float64{"172.160.001.192": 1},
+		},
+		{
+			// The empty object is skipped without download, so that it isn't reported as missing.
+			name:       "S3 event of empty object",
+			payload:    strings.Replace(s3EventJson("my-bucket", "missing.log.gz"), `"size":1024`, `"size":0`, 1),
+			want:       nil,
+			wantCalls:  0,
+			wantCounts: map[string]float64{},
+		},
+		{
+			// The object of unknown size is downloaded.
+			name:    "S3 event of missing object without size",
+			payload: strings.Replace(s3EventJson("my-bucket", "missing.log.gz"), `"size":1024,`, "", 1),
+			wantErr: true,
+		},
+		{
+			name:    "S3 event of missing object",
+			payload: s3EventJson("my-bucket", "missing.log.gz"),
+			wantErr: true,
+		},
+		{
+			name: "SQS event",
+			payload: sqsEventJson(map[string]string{
+				"raw":     s3EventJson("my-bucket", exampleLogObjectKey),
+				"sns":     snsNotificationJson(s3EventJson("my-bucket", exampleLogObjectKey)),
+				"bridge":  exampleEventBridgeObjectCreatedEvent,
+				"test":    `{"Service":"Amazon S3","Event":"s3:TestEvent","Time":"2018-07-02T22:25:00.000Z","Bucket":"my-bucket"}`,
+				"missing": s3EventJson("my-bucket", "missing.log.gz"),
+				"invalid": "not json",
+			}),
+			want: events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{
+				{ItemIdentifier: "invalid"},
+				{ItemIdentifier: "missing"},
+			}},
+			// Messages notifying the same object in different formats are read once.
+			wantCalls:  1,
+			wantCounts: map[string]float64{"172.160.001.192": 1},
+		},
+		{
+			name:       "SQS event of test event only",
+			payload:    sqsEventJson(map[string]string{"test": `{"Service":"Amazon S3","Event":"s3:TestEvent"}`}),
+			want:       events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}},
+			wantCalls:  0,
+			wantCounts: map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			h := newTestEventHandler(t, sink)
+
+			got, err := h.Handle(context.Background(), json.RawMessage(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if response, ok := got.(events.SQSEventResponse); ok {
+				slices.SortFunc(response.BatchItemFailures, func(a, b events.SQSBatchItemFailure) int {
+					return strings.Compare(a.ItemIdentifier, b.ItemIdentifier)
+				})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Handle() = %v, want %v", got, tt.want)
+			}
+			if sink.calls != tt.wantCalls {
+				t.Errorf("Handle() submits %d times, want %d", sink.calls, tt.wantCalls)
+			}
+			counts := map[string]float64{}
+			for _, series := range sink.series {
+				if series.Type == SeriesTypeCount {
+					for _, point := range series.Points {
+						counts[series.TagValue("ip_address")] += point.Value
+					}
+				}
+			}
+			if !reflect.DeepEqual(counts, tt.wantCounts) {
+				t.Errorf("Handle() submits counts %v, want %v", counts, tt.wantCounts)
+			}
+		})
+	}
+}
+
+func TestEventHandler_Handle_processedObjects(t *testing.T) {
+	sink := &recordingSink{}
+	h := newTestEventHandler(t, sink)
+	h.ProcessedObjects = newMemoryProcessedObjectStore()
+
+	// Submission fails at first, so that the object is not marked as processed.
+	sink.err = errors.New("failed")
+	if _, err := h.Handle(context.Background(), json.RawMessage(exampleS3Event)); err == nil {
+		t.Fatal("Handle() error = nil")
+	}
+	sink.err = nil
+	for range 2 {
+		if _, err := h.Handle(context.Background(), json.RawMessage(exampleS3Event)); err != nil {
+			t.Fatalf("Handle() error = %v", err)
+		}
+	}
+	// The object with other ETag is processed again.
+	if _, err := h.Handle(context.Background(), json.RawMessage(strings.Replace(exampleS3Event, "d41d8cd98f00b204e9800998ecf8427e", "9e107d9d372bb6826bd81d3542a419d6", 1))); err != nil {
+		t.Fatalf("Handle() error = %v", err)
+	}
+
+	if sink.calls != 3 {
+		t.Errorf("Handle() submits %d times, want 3", sink.calls)
+	}
+}
+
+// failingMarkStore is the ProcessedObjectStore failing to mark objects as processed.
+type failingMarkStore struct {
+	ProcessedObjectStore
+	attempts int
+}
+
+func (s *failingMarkStore) MarkProcessed(context.Context, S3Object) error {
+	s.attempts++
+	return errors.New("failed")
+}
+
+func TestEventHandler_Handle_markProcessedFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    any
+	}{
+		{name: "S3 event", payload: exampleS3Event, want: nil},
+		{name: "SQS event", payload: sqsEventJson(map[string]string{"raw": exampleS3Event}), want: events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestEventHandler(t, &recordingSink{})
+			store := &failingMarkStore{ProcessedObjectStore: newMemoryProcessedObjectStore()}
+			h.ProcessedObjects = store
+			var slept []time.Duration
+			h.markRetrier = newTestRetrier(&slept)
+
+			// Metrics have been submitted, so the failure is retried and only logged.
+			got, err := h.Handle(context.Background(), json.RawMessage(tt.payload))
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Handle() = %v, want %v", got, tt.want)
+			}
+			if store.attempts != 3 {
+				t.Errorf("MarkProcessed() is called %d times, want 3", store.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// localCommand runs `local` subcommand, which reads log files on local disk and submits metrics aggregated across all of them at once.
+// Arguments are files, directories, glob patterns or `-` for stdin.
+func localCommand(args []string) error {
+	flags := flag.NewFlagSet("local", flag.ContinueOnError)
+	concurrency := flags.Int("concurrency", runtime.NumCPU(), "Max number of log files read concurrently")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("paths of log files are required")
+	}
+
+	paths, err := expandLocalPaths(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	appConfig, err := NewConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	processor, err := NewProcessor(appConfig)
+	if err != nil {
+		return err
+	}
+	logMetrics, err := readLocalLogFiles(processor, paths, *concurrency)
+	if err != nil {
+		return err
+	}
+	return processor.Submit(logMetrics)
+}
+
+// expandLocalPaths expands glob patterns and directories into paths of files.
+// Files in directories are walked recursively in lexical order. A file given multiple times is read once.
+func expandLocalPaths(args []string) ([]string, error) {
+	var paths []string
+	seen := map[string]bool{}
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, arg := range args {
+		if arg == "-" {
+			add(arg)
+			continue
+		}
+
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob pattern %s: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %s", arg)
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return paths, nil
+}
+
+// readLocalLogFiles reads log files concurrently and merges their metrics.
+func readLocalLogFiles(processor *Processor, paths []string, concurrency int) (*LogMetrics, error) {
+	var eg errgroup.Group
+	eg.SetLimit(max(concurrency, 1))
+	results := make([]*LogMetrics, len(paths))
+	for i, path := range paths {
+		eg.Go(func() error {
+			var r io.Reader = os.Stdin
+			if path != "-" {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+
+			logMetrics, err := processor.ReadLogfile(r, path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			results[i] = logMetrics
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	merged := NewLogMetrics()
+	for _, logMetrics := range results {
+		merged.Merge(logMetrics)
+	}
+	fmt.Fprintf(os.Stderr, "read %d log files\n", len(paths))
+	return merged, nil
+}
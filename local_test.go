@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_expandLocalPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.log.gz", "b.log.gz", "day/c.log.gz", "day/nested/d.log.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "files and stdin",
+			args: []string{filepath.Join(dir, "b.log.gz"), "-", filepath.Join(dir, "a.log.gz")},
+			want: []string{filepath.Join(dir, "b.log.gz"), "-", filepath.Join(dir, "a.log.gz")},
+		},
+		{
+			name: "directory",
+			args: []string{filepath.Join(dir, "day")},
+			want: []string{filepath.Join(dir, "day/c.log.gz"), filepath.Join(dir, "day/nested/d.log.gz")},
+		},
+		{
+			name: "glob with duplicated file",
+			args: []string{filepath.Join(dir, "*.log.gz"), filepath.Join(dir, "a.log.gz")},
+			want: []string{filepath.Join(dir, "a.log.gz"), filepath.Join(dir, "b.log.gz")},
+		},
+		{
+			name:    "glob matching nothing",
+			args:    []string{filepath.Join(dir, "*.txt")},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			args:    []string{filepath.Join(dir, "missing.log.gz")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandLocalPaths(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandLocalPaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandLocalPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readLocalLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	name := func(ip string) string {
+		return filepath.Join(dir, "123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20180702T2225Z_"+ip+"_20sg8hgm.log.gz")
+	}
+	files := map[string]string{
+		name("172.160.001.192"): exampleHttpEntry + "\n",
+		name("172.160.001.193"): exampleHttpEntry + "\n" + exampleHttpEntry + "\n",
+		filepath.Join(dir, "other", name("172.160.001.192")[len(dir)+1:]): exampleHttpEntry + "\n",
+	}
+	var paths []string
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, gzipBytes(t, content).Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	processor, _ := newTestProcessor(&Config{TargetProcessingTimeMetricName: "target_processing_time", TargetPaths: []string{"/"}})
+	got, err := readLocalLogFiles(processor, paths, 2)
+	if err != nil {
+		t.Fatalf("readLocalLogFiles() error = %v", err)
+	}
+
+	counts := map[string]RequestCount{}
+	for _, metric := range got.Metrics {
+		for _, count := range metric.RequestCountMap {
+			counts[metric.IpAddress] += count
+		}
+	}
+	want := map[string]RequestCount{"172.160.001.192": 2, "172.160.001.193": 2}
+	if len(got.Metrics) != 2 || !reflect.DeepEqual(counts, want) {
+		t.Errorf("readLocalLogFiles() returns %d metrics with counts %v, want 2 metrics with %v", len(got.Metrics), counts, want)
+	}
+}
@@ -4,69 +4,292 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"maps"
+	"os"
 	"slices"
 	"strings"
 )
 
+const (
+	// MalformedLinesPolicyFail fails reading the log file on a malformed line, which is the default.
+	MalformedLinesPolicyFail = "fail"
+	// MalformedLinesPolicySkip skips malformed lines up to max_count and max_percent of malformed_lines.
+	MalformedLinesPolicySkip = "skip"
+
+	// maxMalformedLineSamples is the max number of malformed lines logged for each log file.
+	maxMalformedLineSamples = 5
+)
+
 type LogFileReader struct {
 	pathTransformingRules []PathTransformingRule
 	targetPaths           []string
+	malformedLines        MalformedLinesConfig
+	collected             collectedValues
+	valueFields           logValueFields
 }
 
-func NewLogFileReader(paths []PathTransformingRule, targetPaths []string) *LogFileReader {
-	return &LogFileReader{pathTransformingRules: paths, targetPaths: targetPaths}
+func NewLogFileReader(config *Config) *LogFileReader {
+	collected := collectedValues{
+		targetProcessingTimes:   config.TargetProcessingTimeMetricName != "",
+		noTargetResponseCounts:  config.NoTargetResponseCountMetricName != "",
+		requestProcessingTimes:  config.RequestProcessingTimeMetricName != "",
+		responseProcessingTimes: config.ResponseProcessingTimeMetricName != "",
+		totalLatencies:          config.TotalLatencyMetricName != "",
+		receivedBytes:           config.ReceivedBytesMetricName != "",
+		sentBytes:               config.SentBytesMetricName != "",
+		requestSizes:            config.RequestSizeMetricName != "",
+		responseSizes:           config.ResponseSizeMetricName != "",
+	}
+	return &LogFileReader{
+		pathTransformingRules: config.PathTransformingRules,
+		targetPaths:           config.TargetPaths,
+		malformedLines:        config.MalformedLines,
+		collected:             collected,
+		valueFields:           collected.valueFields(),
+	}
 }
 
-func (p *LogFileReader) Read(r io.Reader) (map[string]*Metric, error) {
+// collectedValues is the set of optional values of requests collected into Metric, which are enabled by their metric names
+// so that values of disabled metrics don't consume memory.
+type collectedValues struct {
+	targetProcessingTimes   bool
+	noTargetResponseCounts  bool
+	requestProcessingTimes  bool
+	responseProcessingTimes bool
+	totalLatencies          bool
+	receivedBytes           bool
+	sentBytes               bool
+	requestSizes            bool
+	responseSizes           bool
+}
+
+// valueFields returns fields of log records which are parsed to collect the values.
+// Requests without response from target are detected by the target processing time of -1.
+func (c collectedValues) valueFields() logValueFields {
+	return logValueFields{
+		requestProcessingTime:  c.requestProcessingTimes || c.totalLatencies,
+		targetProcessingTime:   c.targetProcessingTimes || c.noTargetResponseCounts || c.totalLatencies,
+		responseProcessingTime: c.responseProcessingTimes || c.totalLatencies,
+		receivedBytes:          c.receivedBytes || c.requestSizes,
+		sentBytes:              c.sentBytes || c.responseSizes,
+	}
+}
+
+// ReadResult is metrics of a log file. Metrics is of ALB and CLB log file, NlbMetrics is of NLB log file,
+// and AlbConnectionMetrics is of ALB connection log file.
+type ReadResult struct {
+	Metrics              map[string]*Metric
+	NlbMetrics           map[string]*NlbMetric
+	AlbConnectionMetrics map[string]*AlbConnectionMetric
+	// Lines is the number of lines in the log file, and MalformedLines is the number of skipped lines of them.
+	Lines          int
+	MalformedLines int
+}
+
+func (p *LogFileReader) Read(r io.Reader) (*ReadResult, error) {
 	scanner := bufio.NewScanner(r)
 
-	metricMap := map[string]*Metric{}
+	result := &ReadResult{Metrics: map[string]*Metric{}}
+	metricMap := result.Metrics
+	// fields is reused across lines. Values of fields used by configured metrics are parsed for every line to detect malformed lines,
+	// and records are built only for lines of target paths.
+	var fields albLogFields
 	for scanner.Scan() {
 		text := scanner.Text()
-		r, err := NewAlbLogRecord(text, p.pathTransformingRules)
+		result.Lines++
+		r, err := p.readRecord(text, &fields)
 		if err != nil {
-			fmt.Printf("failed to read alb log record: %s\n", text)
-			return nil, err
-		}
-
-		if slices.Contains(p.targetPaths, r.RequestPath) {
-			metricKey := r.MetricKey()
-
-			// When metricMap doesn't have key of `metricsKey`, add new Metrics.
-			if _, ok := metricMap[metricKey]; !ok {
-				metricMap[metricKey] = &Metric{
-					RequestCountMap:          map[Timestamp]RequestCount{},
-					TargetProcessingTimesMap: map[Timestamp]TargetProcessingTimes{},
-					Method:                   r.RequestMethod,
-					Path:                     r.RequestPath,
-					ElbStatusCode:            r.ElbStatusCode,
-					TargetStatusCode:         r.TargetStatusCode,
-					Elb:                      r.Elb,
-					TargetGroupArn:           r.TargetGroupArn,
-				}
+			if err := p.skipMalformedLine(result, text, err); err != nil {
+				return nil, err
 			}
-			metric := metricMap[metricKey]
-
-			// When RequestCountMap of metric doesn't have key of timestamp, initialize value to 1.
-			// When RequestCountMap of metric have key of timestamp, increment value.
-			if _, exist := metric.RequestCountMap[r.Timestamp()]; exist {
-				metric.RequestCountMap[r.Timestamp()] = metric.RequestCountMap[r.Timestamp()] + RequestCount(1)
-			} else {
-				metric.RequestCountMap[r.Timestamp()] = RequestCount(1)
+			continue
+		}
+		if r == nil {
+			continue
+		}
+
+		metricKey := r.MetricKey()
+
+		// When metricMap doesn't have key of `metricsKey`, add new Metrics.
+		if _, ok := metricMap[metricKey]; !ok {
+			metricMap[metricKey] = &Metric{
+				RequestCountMap:            map[Timestamp]RequestCount{},
+				TargetProcessingTimesMap:   map[Timestamp]TargetProcessingTimes{},
+				RequestProcessingTimesMap:  map[Timestamp][]float64{},
+				ResponseProcessingTimesMap: map[Timestamp][]float64{},
+				TotalLatenciesMap:          map[Timestamp][]float64{},
+				ReceivedBytesMap:           map[Timestamp]int{},
+				SentBytesMap:               map[Timestamp]int{},
+				RequestSizesMap:            map[Timestamp][]float64{},
+				ResponseSizesMap:           map[Timestamp][]float64{},
+				NoTargetResponseCountsMap:  map[string]map[Timestamp]int{},
+				Method:                     r.RequestMethod,
+				Path:                       r.RequestPath,
+				ElbStatusCode:              r.ElbStatusCode,
+				TargetStatusCode:           r.TargetStatusCode,
+				Elb:                        r.Elb,
+				TargetGroupArn:             r.TargetGroupArn,
 			}
+		}
+		metricMap[metricKey].addRequest(r.Timestamp(), p.collected, requestValues{
+			requestProcessingTime:  r.RequestProcessingTime,
+			targetProcessingTime:   r.TargetProcessingTime,
+			responseProcessingTime: r.ResponseProcessingTime,
+			receivedBytes:          r.ReceivedBytes,
+			sentBytes:              r.SentBytes,
+			errorReason:            r.ErrorReason,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.checkMalformedLines(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readRecord parses the line into fields and returns nil record when the path isn't target.
+// Values of fields used by configured metrics are parsed before filtering by the path, so that malformed lines of any path are detected.
+func (p *LogFileReader) readRecord(line string, fields *albLogFields) (*AlbLogRecord, error) {
+	if err := fields.tokenize(line); err != nil {
+		return nil, err
+	}
+	values, err := fields.parseValues(p.valueFields)
+	if err != nil {
+		return nil, err
+	}
+	path, err := transformRequestPath(fields[albLogFieldRequest], p.pathTransformingRules)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(p.targetPaths, path) {
+		return nil, nil
+	}
+	return newAlbLogRecord(fields, values, path), nil
+}
+
+// skipMalformedLine counts the line as malformed when malformed lines are skipped by the policy, or returns err otherwise.
+func (p *LogFileReader) skipMalformedLine(result *ReadResult, line string, err error) error {
+	if p.malformedLines.Policy != MalformedLinesPolicySkip {
+		fmt.Fprintf(os.Stderr, "failed to read log record: %s\n", line)
+		return err
+	}
+	result.MalformedLines++
+	if result.MalformedLines <= maxMalformedLineSamples {
+		fmt.Fprintf(os.Stderr, "skip malformed log record: %s: %s\n", err, line)
+	}
+	return nil
+}
+
+// checkMalformedLines fails when skipped lines exceed limits of malformed_lines.
+func (p *LogFileReader) checkMalformedLines(result *ReadResult) error {
+	if result.MalformedLines == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "skipped %d malformed lines of %d lines\n", result.MalformedLines, result.Lines)
+
+	c := p.malformedLines
+	if c.MaxCount > 0 && result.MalformedLines > c.MaxCount {
+		return fmt.Errorf("too many malformed lines: %d lines exceed max_count %d", result.MalformedLines, c.MaxCount)
+	}
+	if c.MaxPercent > 0 && float64(result.MalformedLines)*100 > c.MaxPercent*float64(result.Lines) {
+		return fmt.Errorf("too many malformed lines: %d of %d lines exceed max_percent %g", result.MalformedLines, result.Lines, c.MaxPercent)
+	}
+	return nil
+}
+
+// LogMetrics is metrics read from log files, which can be merged across log files.
+type LogMetrics struct {
+	Metrics              map[string]*Metric
+	NlbMetrics           map[string]*NlbMetric
+	AlbConnectionMetrics map[string]*AlbConnectionMetric
+	// MalformedLines is the number of skipped malformed lines of each log type and load balancer.
+	MalformedLines map[string]*MalformedLinesMetric
+}
+
+// MalformedLinesMetric is the number of skipped malformed lines keyed by the timestamp of log files.
+type MalformedLinesMetric struct {
+	CountMap map[Timestamp]int
+	LogType  LogType
+	Elb      string
+}
 
-			// Note: TargetProcessingTime is -1 when load balancer can't dispatch request to target or target doesn't respond until idle timeout.
-			// see: https://docs.aws.amazon.com/ja_jp/elasticloadbalancing/latest/application/load-balancer-access-logs.html
-			targetProcessingTime := TargetProcessingTime(r.TargetProcessingTime)
-			if _, exist := metric.RequestCountMap[r.Timestamp()]; exist {
-				metric.TargetProcessingTimesMap[r.Timestamp()] = append(metric.TargetProcessingTimesMap[r.Timestamp()], targetProcessingTime)
-			} else {
-				metric.TargetProcessingTimesMap[r.Timestamp()] = TargetProcessingTimes{targetProcessingTime}
+func NewLogMetrics() *LogMetrics {
+	return &LogMetrics{
+		Metrics:              map[string]*Metric{},
+		NlbMetrics:           map[string]*NlbMetric{},
+		AlbConnectionMetrics: map[string]*AlbConnectionMetric{},
+		MalformedLines:       map[string]*MalformedLinesMetric{},
+	}
+}
+
+// Merge merges other into m by MergeMetrics. other must not be used after merged.
+func (m *LogMetrics) Merge(other *LogMetrics) {
+	MergeMetrics(m.Metrics, other.Metrics)
+	MergeNlbMetrics(m.NlbMetrics, other.NlbMetrics)
+	MergeAlbConnectionMetrics(m.AlbConnectionMetrics, other.AlbConnectionMetrics)
+	for key, metric := range other.MalformedLines {
+		d, ok := m.MalformedLines[key]
+		if !ok {
+			m.MalformedLines[key] = metric
+			continue
+		}
+		for timestamp, count := range metric.CountMap {
+			d.CountMap[timestamp] += count
+		}
+	}
+}
+
+func (m *LogMetrics) IsEmpty() bool {
+	return len(m.Metrics) == 0 && len(m.NlbMetrics) == 0 && len(m.AlbConnectionMetrics) == 0 && len(m.MalformedLines) == 0
+}
+
+// MergeMetrics merges metrics of src into dst. Metrics of the same key are combined by adding counts and values of each timestamp.
+// Metrics of src may be shared with dst, so src must not be used after merged.
+func MergeMetrics(dst map[string]*Metric, src map[string]*Metric) {
+	for key, metric := range src {
+		d, ok := dst[key]
+		if !ok {
+			dst[key] = metric
+			continue
+		}
+		for timestamp, count := range metric.RequestCountMap {
+			d.RequestCountMap[timestamp] += count
+		}
+		for timestamp, times := range metric.TargetProcessingTimesMap {
+			d.TargetProcessingTimesMap[timestamp] = append(d.TargetProcessingTimesMap[timestamp], times...)
+		}
+		for timestamp, times := range metric.RequestProcessingTimesMap {
+			d.RequestProcessingTimesMap[timestamp] = append(d.RequestProcessingTimesMap[timestamp], times...)
+		}
+		for timestamp, times := range metric.ResponseProcessingTimesMap {
+			d.ResponseProcessingTimesMap[timestamp] = append(d.ResponseProcessingTimesMap[timestamp], times...)
+		}
+		for timestamp, latencies := range metric.TotalLatenciesMap {
+			d.TotalLatenciesMap[timestamp] = append(d.TotalLatenciesMap[timestamp], latencies...)
+		}
+		for timestamp, bytes := range metric.ReceivedBytesMap {
+			d.ReceivedBytesMap[timestamp] += bytes
+		}
+		for timestamp, bytes := range metric.SentBytesMap {
+			d.SentBytesMap[timestamp] += bytes
+		}
+		for timestamp, sizes := range metric.RequestSizesMap {
+			d.RequestSizesMap[timestamp] = append(d.RequestSizesMap[timestamp], sizes...)
+		}
+		for timestamp, sizes := range metric.ResponseSizesMap {
+			d.ResponseSizesMap[timestamp] = append(d.ResponseSizesMap[timestamp], sizes...)
+		}
+		for reason, counts := range metric.NoTargetResponseCountsMap {
+			if d.NoTargetResponseCountsMap[reason] == nil {
+				d.NoTargetResponseCountsMap[reason] = map[Timestamp]int{}
+			}
+			for timestamp, count := range counts {
+				d.NoTargetResponseCountsMap[reason][timestamp] += count
 			}
-			metricMap[metricKey] = metric
 		}
 	}
-	return metricMap, nil
 }
 
 type Timestamp int64
@@ -80,6 +303,11 @@ func (ts *Timestamp) PtrFloat64() *float64 {
 	return &v
 }
 
+// sortedTimestamps returns timestamps of m in ascending order.
+func sortedTimestamps[V any](m map[Timestamp]V) []Timestamp {
+	return slices.Sorted(maps.Keys(m))
+}
+
 type RequestCount float64
 
 func (c *RequestCount) PtrFloat64() *float64 {
@@ -108,12 +336,83 @@ func (t *TargetProcessingTimes) Float64() *[]float64 {
 type Metric struct {
 	RequestCountMap          map[Timestamp]RequestCount
 	TargetProcessingTimesMap map[Timestamp]TargetProcessingTimes
-	Method                   string
-	Path                     string
-	ElbStatusCode            string
-	TargetStatusCode         string
-	Elb                      string
-	TargetGroupArn           string
+	// RequestProcessingTimesMap, ResponseProcessingTimesMap and TotalLatenciesMap are seconds excluding -1 of requests not dispatched to target.
+	// TotalLatenciesMap is the sum of request, target and response processing times. They are empty unless their metric names are configured.
+	RequestProcessingTimesMap  map[Timestamp][]float64
+	ResponseProcessingTimesMap map[Timestamp][]float64
+	TotalLatenciesMap          map[Timestamp][]float64
+	// ReceivedBytesMap and SentBytesMap are total bytes of requests, which are empty unless their metric names are configured.
+	ReceivedBytesMap map[Timestamp]int
+	SentBytesMap     map[Timestamp]int
+	// RequestSizesMap and ResponseSizesMap are received and sent bytes of each request, which are empty unless their metric names are configured.
+	RequestSizesMap  map[Timestamp][]float64
+	ResponseSizesMap map[Timestamp][]float64
+	// NoTargetResponseCountsMap is the number of requests without response from target, keyed by error reason.
+	NoTargetResponseCountsMap map[string]map[Timestamp]int
+	Method                    string
+	Path                      string
+	ElbStatusCode             string
+	TargetStatusCode          string
+	Elb                       string
+	TargetGroupArn            string
+	// IpAddress is the IP address of load balancer node which wrote the log file.
+	IpAddress string
+	// LogType is LogTypeClb when the metric is of CLB, whose target is called backend and TargetGroupArn is empty.
+	LogType LogType
+}
+
+// requestValues is values of a request aggregated into Metric, which are common to ALB and CLB.
+type requestValues struct {
+	requestProcessingTime  float64
+	targetProcessingTime   float64
+	responseProcessingTime float64
+	receivedBytes          int
+	sentBytes              int
+	errorReason            string
+}
+
+// addRequest counts a request and its processing times and sizes at the timestamp.
+// Optional values are added only when they are collected.
+func (m *Metric) addRequest(timestamp Timestamp, collected collectedValues, values requestValues) {
+	m.RequestCountMap[timestamp]++
+	// Note: TargetProcessingTime is -1 when load balancer can't dispatch request to target or target doesn't respond until idle timeout.
+	// It is counted by the error reason instead of the distribution, whose percentiles would be dragged negative.
+	// see: https://docs.aws.amazon.com/ja_jp/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+	if values.targetProcessingTime >= 0 {
+		if collected.targetProcessingTimes {
+			m.TargetProcessingTimesMap[timestamp] = append(m.TargetProcessingTimesMap[timestamp], TargetProcessingTime(values.targetProcessingTime))
+		}
+	} else if collected.noTargetResponseCounts {
+		if m.NoTargetResponseCountsMap[values.errorReason] == nil {
+			m.NoTargetResponseCountsMap[values.errorReason] = map[Timestamp]int{}
+		}
+		m.NoTargetResponseCountsMap[values.errorReason][timestamp]++
+	}
+
+	// Request and response processing times are also -1 in that case, and the total latency is meaningless when any of them is -1.
+	if collected.requestProcessingTimes && values.requestProcessingTime >= 0 {
+		m.RequestProcessingTimesMap[timestamp] = append(m.RequestProcessingTimesMap[timestamp], values.requestProcessingTime)
+	}
+	if collected.responseProcessingTimes && values.responseProcessingTime >= 0 {
+		m.ResponseProcessingTimesMap[timestamp] = append(m.ResponseProcessingTimesMap[timestamp], values.responseProcessingTime)
+	}
+	if collected.totalLatencies && values.requestProcessingTime >= 0 && values.targetProcessingTime >= 0 && values.responseProcessingTime >= 0 {
+		total := values.requestProcessingTime + values.targetProcessingTime + values.responseProcessingTime
+		m.TotalLatenciesMap[timestamp] = append(m.TotalLatenciesMap[timestamp], total)
+	}
+
+	if collected.receivedBytes {
+		m.ReceivedBytesMap[timestamp] += values.receivedBytes
+	}
+	if collected.sentBytes {
+		m.SentBytesMap[timestamp] += values.sentBytes
+	}
+	if collected.requestSizes {
+		m.RequestSizesMap[timestamp] = append(m.RequestSizesMap[timestamp], float64(values.receivedBytes))
+	}
+	if collected.responseSizes {
+		m.ResponseSizesMap[timestamp] = append(m.ResponseSizesMap[timestamp], float64(values.sentBytes))
+	}
 }
 
 func (m *Metric) TargetStatusCodeGroup() string {
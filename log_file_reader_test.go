@@ -9,9 +9,11 @@ import (
 )
 
 func TestLogFileReader_Read(t *testing.T) {
-	var pathRules []PathTransformingRule
-	targetPaths := []string{"/"}
-	logFileReader := NewLogFileReader(pathRules, targetPaths)
+	logFileReader := NewLogFileReader(&Config{
+		TargetPaths:                     []string{"/"},
+		TargetProcessingTimeMetricName:  "target_processing_time",
+		NoTargetResponseCountMetricName: "no_target_response_count",
+	})
 
 	logTimeString := "2022-06-13T00:26:00.071316Z"
 	logTime, err := time.Parse(time.RFC3339, "2022-06-13T00:26:00.071316Z")
@@ -23,6 +25,7 @@ func TestLogFileReader_Read(t *testing.T) {
 		log                          string
 		wantTargetProcessingTimesMap map[Timestamp]TargetProcessingTimes
 		wantTargetRequestCountMap    map[Timestamp]RequestCount
+		wantNoTargetResponseCounts   map[string]map[Timestamp]int
 	}{
 		{
 			log: fmt.Sprintf(`https %s app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 200 200 0 57 "GET https://www.example.com:443/ HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337281-1d84f3d73c47ec4e58577259" "www.example.com" "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012" 1 2018-07-02T22:22:48.364000Z "authenticate,forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`, logTimeString),
@@ -32,24 +35,28 @@ func TestLogFileReader_Read(t *testing.T) {
 			wantTargetRequestCountMap: map[Timestamp]RequestCount{
 				Timestamp(logTime.Unix()): 1,
 			},
+			wantNoTargetResponseCounts: map[string]map[Timestamp]int{},
 		},
 		{
 			log: fmt.Sprintf(`https %s app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 - -1 -1 -1 400 - 235 772 "GET https://www.example.com:443/ HTTP/1.1" "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/81.0.4044.129 Safari/537.36" - - - "-" "-" "-" - 2022-06-13T00:25:59.856000Z "-" "-" "-" "-" "-" "-" "-"`, logTimeString),
-			wantTargetProcessingTimesMap: map[Timestamp]TargetProcessingTimes{
-				Timestamp(logTime.Unix()): {-1},
-			},
+			// -1 of the request not dispatched to target is counted by the error reason instead.
+			wantTargetProcessingTimesMap: map[Timestamp]TargetProcessingTimes{},
 			wantTargetRequestCountMap: map[Timestamp]RequestCount{
 				Timestamp(logTime.Unix()): 1,
 			},
+			wantNoTargetResponseCounts: map[string]map[Timestamp]int{
+				"-": {Timestamp(logTime.Unix()): 1},
+			},
 		},
 	}
 	for _, tt := range cases {
-		metricMap, err := logFileReader.Read(
+		result, err := logFileReader.Read(
 			strings.NewReader(tt.log),
 		)
 		if err != nil {
 			t.Fatalf("failed to read the log: %v\n%s", err, tt.log)
 		}
+		metricMap := result.Metrics
 		if len(metricMap) != 1 {
 			t.Errorf("expected 1 metric, got %d", len(metricMap))
 		}
@@ -61,7 +68,191 @@ func TestLogFileReader_Read(t *testing.T) {
 			if reflect.DeepEqual(metric.RequestCountMap, tt.wantTargetRequestCountMap) == false {
 				t.Errorf("unexpected got %v, want, %v", metric.RequestCountMap, tt.wantTargetRequestCountMap)
 			}
+			if reflect.DeepEqual(metric.NoTargetResponseCountsMap, tt.wantNoTargetResponseCounts) == false {
+				t.Errorf("unexpected got %v, want, %v", metric.NoTargetResponseCountsMap, tt.wantNoTargetResponseCounts)
+			}
+
+		}
+	}
+}
+
+func TestLogFileReader_Read_processingTimes(t *testing.T) {
+	// Processing times aren't collected unless their metric names are configured.
+	result, err := NewLogFileReader(&Config{TargetPaths: []string{"/"}}).Read(strings.NewReader(exampleHttpsEntry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, metric := range result.Metrics {
+		if len(metric.RequestProcessingTimesMap) != 0 || len(metric.ResponseProcessingTimesMap) != 0 || len(metric.TotalLatenciesMap) != 0 {
+			t.Errorf("unexpected processing times of metrics not configured %+v", metric)
+		}
+	}
+
+	logFileReader := NewLogFileReader(&Config{
+		TargetPaths:                      []string{"/"},
+		RequestProcessingTimeMetricName:  "request_processing_time",
+		ResponseProcessingTimeMetricName: "response_processing_time",
+		TotalLatencyMetricName:           "total_latency",
+	})
+	result, err = logFileReader.Read(strings.NewReader(exampleHttpsEntry + "\n" + exampleLoadBalancerCouldNotDispatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(result.Metrics))
+	}
+
+	timestamp := Timestamp(1530570180)
+	requestProcessingTime, targetProcessingTime, responseProcessingTime := 0.086, 0.048, 0.037
+	for _, metric := range result.Metrics {
+		if metric.ElbStatusCode == "400" {
+			// -1 of the request not dispatched to target is excluded.
+			if len(metric.RequestProcessingTimesMap) != 0 || len(metric.ResponseProcessingTimesMap) != 0 || len(metric.TotalLatenciesMap) != 0 {
+				t.Errorf("unexpected processing times of the request not dispatched %+v", metric)
+			}
+			continue
+		}
+		if want := (map[Timestamp][]float64{timestamp: {requestProcessingTime}}); !reflect.DeepEqual(metric.RequestProcessingTimesMap, want) {
+			t.Errorf("RequestProcessingTimesMap = %v, want %v", metric.RequestProcessingTimesMap, want)
+		}
+		if want := (map[Timestamp][]float64{timestamp: {responseProcessingTime}}); !reflect.DeepEqual(metric.ResponseProcessingTimesMap, want) {
+			t.Errorf("ResponseProcessingTimesMap = %v, want %v", metric.ResponseProcessingTimesMap, want)
+		}
+		if want := (map[Timestamp][]float64{timestamp: {requestProcessingTime + targetProcessingTime + responseProcessingTime}}); !reflect.DeepEqual(metric.TotalLatenciesMap, want) {
+			t.Errorf("TotalLatenciesMap = %v, want %v", metric.TotalLatenciesMap, want)
+		}
+	}
+}
+
+func TestLogFileReader_Read_sizes(t *testing.T) {
+	timestamp := Timestamp(1530570180)
+	// Total bytes and sizes of each request aren't collected unless their metric names are configured.
+	result, err := NewLogFileReader(&Config{TargetPaths: []string{"/"}}).Read(strings.NewReader(exampleHttpsEntry + "\n" + exampleHttpsEntry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, metric := range result.Metrics {
+		if len(metric.ReceivedBytesMap) != 0 || len(metric.SentBytesMap) != 0 || len(metric.RequestSizesMap) != 0 || len(metric.ResponseSizesMap) != 0 {
+			t.Errorf("unexpected bytes of metrics not configured %+v", metric)
+		}
+	}
 
+	logFileReader := NewLogFileReader(&Config{
+		TargetPaths:             []string{"/"},
+		ReceivedBytesMetricName: "received_bytes",
+		SentBytesMetricName:     "sent_bytes",
+		RequestSizeMetricName:   "request_size",
+		ResponseSizeMetricName:  "response_size",
+	})
+	result, err = logFileReader.Read(strings.NewReader(exampleHttpsEntry + "\n" + exampleHttpsEntry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Metrics) != 1 {
+		t.Fatalf("expected 1 metric, got %d", len(result.Metrics))
+	}
+	for _, metric := range result.Metrics {
+		if want := (map[Timestamp]int{timestamp: 0}); !reflect.DeepEqual(metric.ReceivedBytesMap, want) {
+			t.Errorf("ReceivedBytesMap = %v, want %v", metric.ReceivedBytesMap, want)
+		}
+		if want := (map[Timestamp]int{timestamp: 114}); !reflect.DeepEqual(metric.SentBytesMap, want) {
+			t.Errorf("SentBytesMap = %v, want %v", metric.SentBytesMap, want)
 		}
+		if want := (map[Timestamp][]float64{timestamp: {0, 0}}); !reflect.DeepEqual(metric.RequestSizesMap, want) {
+			t.Errorf("RequestSizesMap = %v, want %v", metric.RequestSizesMap, want)
+		}
+		if want := (map[Timestamp][]float64{timestamp: {57, 57}}); !reflect.DeepEqual(metric.ResponseSizesMap, want) {
+			t.Errorf("ResponseSizesMap = %v, want %v", metric.ResponseSizesMap, want)
+		}
+	}
+}
+
+func TestMergeMetrics(t *testing.T) {
+	dst := map[string]*Metric{
+		"a": {
+			RequestCountMap:           map[Timestamp]RequestCount{1: 1, 2: 2},
+			TargetProcessingTimesMap:  map[Timestamp]TargetProcessingTimes{1: {0.1}, 2: {0.2, 0.3}},
+			TotalLatenciesMap:         map[Timestamp][]float64{1: {0.2}},
+			SentBytesMap:              map[Timestamp]int{1: 100},
+			NoTargetResponseCountsMap: map[string]map[Timestamp]int{"-": {1: 1}},
+		},
+	}
+	src := map[string]*Metric{
+		"a": {
+			RequestCountMap:           map[Timestamp]RequestCount{2: 1, 3: 1},
+			TargetProcessingTimesMap:  map[Timestamp]TargetProcessingTimes{2: {0.4}, 3: {0.5}},
+			TotalLatenciesMap:         map[Timestamp][]float64{1: {0.3}, 3: {0.6}},
+			SentBytesMap:              map[Timestamp]int{1: 20, 3: 30},
+			NoTargetResponseCountsMap: map[string]map[Timestamp]int{"-": {1: 1, 2: 1}, "TargetConnectionError": {3: 1}},
+		},
+		"b": {
+			RequestCountMap:          map[Timestamp]RequestCount{1: 1},
+			TargetProcessingTimesMap: map[Timestamp]TargetProcessingTimes{1: {0.6}},
+		},
+	}
+	MergeMetrics(dst, src)
+
+	if len(dst) != 2 || dst["b"] != src["b"] {
+		t.Fatalf("MergeMetrics() = %v", dst)
+	}
+	if want := (map[Timestamp]RequestCount{1: 1, 2: 3, 3: 1}); !reflect.DeepEqual(dst["a"].RequestCountMap, want) {
+		t.Errorf("RequestCountMap = %v, want %v", dst["a"].RequestCountMap, want)
+	}
+	if want := (map[Timestamp]TargetProcessingTimes{1: {0.1}, 2: {0.2, 0.3, 0.4}, 3: {0.5}}); !reflect.DeepEqual(dst["a"].TargetProcessingTimesMap, want) {
+		t.Errorf("TargetProcessingTimesMap = %v, want %v", dst["a"].TargetProcessingTimesMap, want)
+	}
+	if want := (map[Timestamp][]float64{1: {0.2, 0.3}, 3: {0.6}}); !reflect.DeepEqual(dst["a"].TotalLatenciesMap, want) {
+		t.Errorf("TotalLatenciesMap = %v, want %v", dst["a"].TotalLatenciesMap, want)
+	}
+	if want := (map[Timestamp]int{1: 120, 3: 30}); !reflect.DeepEqual(dst["a"].SentBytesMap, want) {
+		t.Errorf("SentBytesMap = %v, want %v", dst["a"].SentBytesMap, want)
+	}
+	if want := (map[string]map[Timestamp]int{"-": {1: 2, 2: 1}, "TargetConnectionError": {3: 1}}); !reflect.DeepEqual(dst["a"].NoTargetResponseCountsMap, want) {
+		t.Errorf("NoTargetResponseCountsMap = %v, want %v", dst["a"].NoTargetResponseCountsMap, want)
+	}
+}
+
+func TestLogFileReader_Read_malformedLines(t *testing.T) {
+	// Malformed lines of paths other than target are also counted when the malformed field is used by configured metrics.
+	malformedOtherPath := strings.Replace(exampleHttpEntry, `34 366 "GET http://www.example.com:80/ `, `34 garbage "GET http://www.example.com:80/other `, 1)
+	lines := []string{exampleHttpEntry, "garbage", exampleHttpEntry, `http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 "`, exampleHttpEntry, malformedOtherPath}
+	tests := []struct {
+		name          string
+		config        MalformedLinesConfig
+		wantMalformed int
+		wantRequests  RequestCount
+		wantErr       bool
+	}{
+		{name: "fail by default", config: MalformedLinesConfig{}, wantErr: true},
+		{name: "fail", config: MalformedLinesConfig{Policy: "fail"}, wantErr: true},
+		{name: "skip", config: MalformedLinesConfig{Policy: "skip"}, wantMalformed: 3, wantRequests: 3},
+		{name: "skip up to count", config: MalformedLinesConfig{Policy: "skip", MaxCount: 3}, wantMalformed: 3, wantRequests: 3},
+		{name: "exceed max count", config: MalformedLinesConfig{Policy: "skip", MaxCount: 2}, wantErr: true},
+		{name: "skip up to percent", config: MalformedLinesConfig{Policy: "skip", MaxPercent: 50}, wantMalformed: 3, wantRequests: 3},
+		{name: "exceed max percent", config: MalformedLinesConfig{Policy: "skip", MaxPercent: 49.9}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewLogFileReader(&Config{TargetPaths: []string{"/"}, SentBytesMetricName: "sent_bytes", MalformedLines: tt.config})
+			got, err := reader.Read(strings.NewReader(strings.Join(lines, "\n")))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Lines != len(lines) || got.MalformedLines != tt.wantMalformed {
+				t.Errorf("Read() reads %d lines with %d malformed lines, want %d lines with %d", got.Lines, got.MalformedLines, len(lines), tt.wantMalformed)
+			}
+			var requests RequestCount
+			for _, metric := range got.Metrics {
+				for _, count := range metric.RequestCountMap {
+					requests += count
+				}
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("Read() counts %v requests, want %v", requests, tt.wantRequests)
+			}
+		})
 	}
 }
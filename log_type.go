@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net/netip"
+	"path"
+	"strings"
+	"time"
+)
+
+// LogType is the type of access log, which selects the parser and metrics of the log file.
+type LogType int
+
+const (
+	LogTypeAlb LogType = iota
+	LogTypeNlb
+	LogTypeClb
+	LogTypeAlbConnection
+)
+
+func (t LogType) String() string {
+	switch t {
+	case LogTypeAlb:
+		return "alb"
+	case LogTypeNlb:
+		return "nlb"
+	case LogTypeClb:
+		return "clb"
+	case LogTypeAlbConnection:
+		return "alb_connection"
+	}
+	return "unknown"
+}
+
+// detectLogType returns the log type by the name of log file, or by `type` field of the first record when the name doesn't tell it (e.g. stdin).
+// The reader is only peeked, so that the record is read again by the parser.
+func detectLogType(s3ObjectKey string, r *bufio.Reader) LogType {
+	if t, ok := logTypeFromObjectKey(s3ObjectKey); ok {
+		return t
+	}
+	return logTypeFromRecordType(r)
+}
+
+// albConnectionLogFilePrefix is the prefix of the name of ALB's connection log file, which is followed by the name in the same layout as access log file.
+// e.g. `conn_log.123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20180702T2225Z_172.160.001.192_20sg8hgm.log.gz`
+// see: https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-connection-logs.html#connection-log-file-format
+const albConnectionLogFilePrefix = "conn_log."
+
+// logFileNameFields returns fields separated by underscore of the name of log file, without the prefix of connection log file.
+func logFileNameFields(s3ObjectKey string) []string {
+	return strings.Split(strings.TrimPrefix(path.Base(s3ObjectKey), albConnectionLogFilePrefix), "_")
+}
+
+// logTypeFromObjectKey returns the log type by the load balancer ID in the name of log file.
+// e.g. `123456789012_elasticloadbalancing_us-east-2_net.my-loadbalancer.1234567890abcdef_20140215T2340Z_20sg8hgm.log.gz`
+// CLB's log file has the name of load balancer, which has no dot, instead of the ID.
+// e.g. `123456789012_elasticloadbalancing_us-west-2_my-loadbalancer_20140215T2340Z_172.160.001.192_20sg8hgm.log`
+// see: https://docs.aws.amazon.com/elasticloadbalancing/latest/network/load-balancer-access-logs.html#access-log-file-format
+// see: https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html#access-log-file-format
+func logTypeFromObjectKey(s3ObjectKey string) (LogType, bool) {
+	fields := logFileNameFields(s3ObjectKey)
+	if len(fields) < 4 || fields[1] != "elasticloadbalancing" {
+		return 0, false
+	}
+	switch {
+	case strings.HasPrefix(path.Base(s3ObjectKey), albConnectionLogFilePrefix):
+		return LogTypeAlbConnection, true
+	case strings.HasPrefix(fields[3], "app."):
+		return LogTypeAlb, true
+	case strings.HasPrefix(fields[3], "net."):
+		return LogTypeNlb, true
+	case fields[3] != "" && !strings.Contains(fields[3], "."):
+		return LogTypeClb, true
+	}
+	return 0, false
+}
+
+// maxRecordTypeLength is enough to peek `type` field of records, e.g. `https` and `grpcs` of ALB and `tls` of NLB,
+// and the time and the next field of records of CLB and ALB's connection log which have no `type` field.
+const maxRecordTypeLength = 80
+
+// logTypeFromRecordType returns the log type by `type` field of the first record. ALB is the default for compatibility.
+// Records starting with time are of ALB's connection log when the next field is client IP address, or CLB's otherwise.
+func logTypeFromRecordType(r *bufio.Reader) LogType {
+	// Peek returns available bytes with error when the log file is shorter.
+	b, _ := r.Peek(maxRecordTypeLength)
+	recordType, rest, _ := bytes.Cut(b, []byte(" "))
+	switch string(recordType) {
+	case "tls":
+		return LogTypeNlb
+	}
+	if _, err := time.Parse(time.RFC3339, string(recordType)); err == nil {
+		next, _, _ := bytes.Cut(rest, []byte(" "))
+		if _, err := netip.ParseAddr(string(next)); err == nil {
+			return LogTypeAlbConnection
+		}
+		return LogTypeClb
+	}
+	return LogTypeAlb
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_detectLogType(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		log  string
+		want LogType
+	}{
+		{
+			name: "ALB log file",
+			key:  exampleLogObjectKey,
+			log:  exampleNlbEntry,
+			want: LogTypeAlb,
+		},
+		{
+			name: "NLB log file",
+			key:  "prefix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/12/20/123456789012_elasticloadbalancing_us-east-2_net.my-network-loadbalancer.c6e77e28c25b2234_20181220T0300Z_8a2f0b8c.log.gz",
+			log:  exampleHttpEntry,
+			want: LogTypeNlb,
+		},
+		{
+			name: "CLB log file",
+			key:  "AWSLogs/123456789012/elasticloadbalancing/us-west-2/2014/02/15/123456789012_elasticloadbalancing_us-west-2_my-loadbalancer_20140215T2340Z_172.160.001.192_20sg8hgm.log",
+			log:  exampleHttpEntry,
+			want: LogTypeClb,
+		},
+		{
+			name: "ALB connection log file",
+			key:  exampleAlbConnectionLogObjectKey,
+			log:  exampleClbHttpEntry,
+			want: LogTypeAlbConnection,
+		},
+		{
+			name: "ALB record from stdin",
+			key:  "-",
+			log:  exampleHttpsEntry,
+			want: LogTypeAlb,
+		},
+		{
+			name: "NLB record from stdin",
+			key:  "-",
+			log:  exampleNlbEntry,
+			want: LogTypeNlb,
+		},
+		{
+			name: "CLB record from stdin",
+			key:  "-",
+			log:  exampleClbHttpEntry,
+			want: LogTypeClb,
+		},
+		{
+			name: "ALB connection record from stdin",
+			key:  "-",
+			log:  exampleAlbConnectionEntry,
+			want: LogTypeAlbConnection,
+		},
+		{
+			name: "ALB connection record of IPv6 client from stdin",
+			key:  "-",
+			log:  exampleAlbConnectionFailedEntry,
+			want: LogTypeAlbConnection,
+		},
+		{
+			name: "short log file",
+			key:  "test.log",
+			log:  "tls",
+			want: LogTypeNlb,
+		},
+		{
+			name: "empty log file",
+			key:  "test.log",
+			log:  "",
+			want: LogTypeAlb,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.log))
+			if got := detectLogType(tt.key, r); got != tt.want {
+				t.Errorf("detectLogType() = %v, want %v", got, tt.want)
+			}
+			// The record must be read again by the parser.
+			if b, _ := io.ReadAll(r); string(b) != tt.log {
+				t.Errorf("detectLogType() consumes the log: %q", b)
+			}
+		})
+	}
+}
@@ -2,81 +2,66 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 func main() {
-	if os.Getenv("LOCAL_INVOKE_GZ_PATH") == "" {
+	var err error
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "backfill":
+		err = backfillCommand(context.Background(), os.Args[2:])
+	case len(os.Args) > 1 && os.Args[1] == "local":
+		err = localCommand(os.Args[2:])
+	case os.Getenv("LOCAL_INVOKE_GZ_PATH") != "":
+		err = devHandler()
+	default:
 		lambda.Start(handler)
-	} else {
-		if err := devHandler(); err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
-		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
 	}
 }
 
+// devHandler processes the log file of LOCAL_INVOKE_GZ_PATH, which is kept for compatibility with `local` subcommand.
 func devHandler() error {
-	fmt.Println("start download from s3")
-	processor, err := NewProcessor()
-	if err != nil {
-		return err
-	}
+	return localCommand([]string{os.Getenv("LOCAL_INVOKE_GZ_PATH")})
+}
+
+// handler accepts S3 event, or SQS event whose messages are S3 event notifications.
+func handler(ctx context.Context, payload json.RawMessage) (any, error) {
+	fmt.Fprintln(os.Stderr, "start handler")
 
-	f, err := os.Open(os.Getenv("LOCAL_INVOKE_GZ_PATH"))
+	appConfig, err := NewConfigFromEnv()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
-
-	err = processor.ProcessLogfile(f, f.Name())
+	processor, err := NewProcessor(appConfig)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
-}
-
-func handler(s3Event events.S3Event) error {
-	fmt.Println("start handler")
-
-	processor, err := NewProcessor()
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	cfg, err := config.LoadDefaultConfig(context.Background())
+	processedObjects, err := NewProcessedObjectStore(appConfig, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	svc := s3.NewFromConfig(cfg)
-
-	for _, record := range s3Event.Records {
-		fmt.Printf("%+v\n", record)
+	h := &EventHandler{Processor: processor, S3: s3.NewFromConfig(cfg), ProcessedObjects: processedObjects}
 
-		obj, err := svc.GetObject(context.Background(), &s3.GetObjectInput{
-			Bucket: &record.S3.Bucket.Name,
-			Key:    &record.S3.Object.Key,
-		})
-		if err != nil {
-			return err
-		}
-
-		fmt.Println("finish download from s3")
-
-		err = processor.ProcessLogfile(obj.Body, record.S3.Object.Key)
-		if err != nil {
-			return err
-		}
-		fmt.Println("finish processLogFile")
+	response, err := h.Handle(ctx, payload)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Println("finish handler")
-	return nil
+	fmt.Fprintln(os.Stderr, "finish handler")
+	return response, nil
 }
@@ -8,68 +8,102 @@ import (
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
+	"net/http"
 	"os"
-	"strings"
 )
 
+const (
+	// defaultMaxSeriesPerRequest is used when max_series_per_request is not configured.
+	defaultMaxSeriesPerRequest = 1000
+	// defaultSubmitConcurrency is used when submit_concurrency is not configured.
+	defaultSubmitConcurrency = 8
+)
+
+// MetricsSubmitter is the Sink submitting series to Datadog API.
 type MetricsSubmitter struct {
-	requestCountMetricName         string
-	targetProcessingTimeMetricName string
-	customTags                     []Tag
+	maxSeriesPerRequest int
+	retrier             *Retrier
+	submitConcurrency   int
+	apiConfiguration    *datadog.Configuration
 }
 
-func NewMetricsSubmitter(requestCountMetricName string, targetProcessingTimeMetricName string, customTags []Tag) *MetricsSubmitter {
+func NewMetricsSubmitter(config *Config) *MetricsSubmitter {
+	maxSeriesPerRequest := config.MaxSeriesPerRequest
+	if maxSeriesPerRequest == 0 {
+		maxSeriesPerRequest = defaultMaxSeriesPerRequest
+	}
+	submitConcurrency := config.SubmitConcurrency
+	if submitConcurrency == 0 {
+		submitConcurrency = defaultSubmitConcurrency
+	}
 	return &MetricsSubmitter{
-		requestCountMetricName:         requestCountMetricName,
-		targetProcessingTimeMetricName: targetProcessingTimeMetricName,
-		customTags:                     customTags}
+		maxSeriesPerRequest: maxSeriesPerRequest,
+		retrier:             NewRetrier(config.SubmitRetry),
+		submitConcurrency:   submitConcurrency,
+		apiConfiguration:    datadog.NewConfiguration(),
+	}
 }
 
-func (p *MetricsSubmitter) Submit(metrics map[string]*Metric, s3ObjectKey string) error {
+func (p *MetricsSubmitter) Submit(series []Series) error {
 	var eg errgroup.Group
+	// All of requests to Datadog share this limit.
+	eg.SetLimit(p.submitConcurrency)
 
 	ctx := datadog.NewDefaultContext(context.Background())
-	apiClient := datadog.NewAPIClient(datadog.NewConfiguration())
+	apiClient := datadog.NewAPIClient(p.apiConfiguration)
 	// v1Api is used to submit distribution points api. This api is defined by v1, so need client for it.
 	v1Api := datadogV1.NewMetricsApi(apiClient)
 	// v2Api is used to submit metrics api. This api is defined by v1 and v2, but v1 api is deprecated.
 	v2Api := datadogV2.NewMetricsApi(apiClient)
 
-	for _, metric := range metrics {
-		metricsPayload := datadogV2.MetricPayload{
-			Series: []datadogV2.MetricSeries{
-				p.requestCountSeries(metric, s3ObjectKey),
-			},
+	var metricSeries []datadogV2.MetricSeries
+	var distributionPointsSeries []datadogV1.DistributionPointsSeries
+	for _, s := range series {
+		switch s.Type {
+		case SeriesTypeCount:
+			metricSeries = append(metricSeries, p.metricSeries(s))
+		case SeriesTypeDistribution:
+			distributionPointsSeries = append(distributionPointsSeries, p.distributionPointsSeries(s))
 		}
+	}
 
-		distributionPointPayload := datadogV1.DistributionPointsPayload{}
-		s, err := p.targetProcessingTime(metric, s3ObjectKey)
-		if err != nil {
-			return err
-		}
-		distributionPointPayload.Series = append(distributionPointPayload.Series, s...)
+	metricsBatches, err := splitSeries(metricSeries, seriesPayloadLimits, p.maxSeriesPerRequest)
+	if err != nil {
+		return err
+	}
+	distributionPointsBatches, err := splitSeries(distributionPointsSeries, distributionPointsPayloadLimits, p.maxSeriesPerRequest)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "submit %d series in %d requests and %d distribution points series in %d requests\n",
+		len(metricSeries), len(metricsBatches), len(distributionPointsSeries), len(distributionPointsBatches))
 
+	for _, batch := range distributionPointsBatches {
+		distributionPointPayload := datadogV1.DistributionPointsPayload{Series: batch}
 		eg.Go(func() error {
-			_, r, err := v1Api.SubmitDistributionPoints(ctx, distributionPointPayload, *datadogV1.NewSubmitDistributionPointsOptionalParameters().WithContentEncoding(datadogV1.DISTRIBUTIONPOINTSCONTENTENCODING_DEFLATE))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error when calling `MetricsApi.SubmitDistributionPoints`: %v\n", err)
-				fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-				return err
-			}
-			return nil
+			return p.retrier.Do(ctx, "MetricsApi.SubmitDistributionPoints", func() (*http.Response, error) {
+				_, r, err := v1Api.SubmitDistributionPoints(ctx, distributionPointPayload, *datadogV1.NewSubmitDistributionPointsOptionalParameters().WithContentEncoding(datadogV1.DISTRIBUTIONPOINTSCONTENTENCODING_DEFLATE))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error when calling `MetricsApi.SubmitDistributionPoints`: %v\n", err)
+					fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
+				}
+				return r, err
+			})
 		})
+	}
 
-		if p.requestCountMetricName != "" {
-			eg.Go(func() error {
-				_, r, err := v2Api.SubmitMetrics(ctx, metricsPayload, *datadogV2.NewSubmitMetricsOptionalParameters())
+	for _, batch := range metricsBatches {
+		metricsPayload := datadogV2.MetricPayload{Series: batch}
+		eg.Go(func() error {
+			return p.retrier.Do(ctx, "MetricsApi.SubmitMetrics", func() (*http.Response, error) {
+				_, r, err := v2Api.SubmitMetrics(ctx, metricsPayload, *datadogV2.NewSubmitMetricsOptionalParameters().WithContentEncoding(datadogV2.METRICCONTENTENCODING_DEFLATE))
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Error when calling `MetricsApi.SubmitMetrics`: %v\n", err)
 					fmt.Fprintf(os.Stderr, "Full HTTP response: %v\n", r)
-					return err
 				}
-				return nil
+				return r, err
 			})
-		}
+		})
 	}
 
 	if err := eg.Wait(); err != nil {
@@ -79,65 +113,31 @@ func (p *MetricsSubmitter) Submit(metrics map[string]*Metric, s3ObjectKey string
 	return nil
 }
 
-func (p *MetricsSubmitter) requestCountSeries(metric *Metric, s3ObjectKey string) datadogV2.MetricSeries {
-	var points []datadogV2.MetricPoint
-	for timestamp, count := range metric.RequestCountMap {
+func (p *MetricsSubmitter) metricSeries(s Series) datadogV2.MetricSeries {
+	points := make([]datadogV2.MetricPoint, 0, len(s.Points))
+	for _, point := range s.Points {
 		points = append(points, datadogV2.MetricPoint{
-			Timestamp: timestamp.PtrInt64(),
-			Value:     count.PtrFloat64(),
+			Timestamp: point.Timestamp.PtrInt64(),
+			Value:     datadog.PtrFloat64(point.Value),
 		})
 	}
-	series := datadogV2.NewMetricSeries(p.requestCountMetricName, points)
+	series := datadogV2.NewMetricSeries(s.Name, points)
 	series.SetType(datadogV2.METRICINTAKETYPE_COUNT)
 	series.SetInterval(60)
-	series.SetUnit("request")
-	tags := []string{
-		fmt.Sprintf("elb:%s", metric.Elb),
-		fmt.Sprintf("target_group_arn:%s", metric.TargetGroupArn),
-		fmt.Sprintf("path:%s", metric.Path),
-		fmt.Sprintf("method:%s", metric.Method),
-		fmt.Sprintf("elb_status_code:%s", metric.ElbStatusCode),
-		fmt.Sprintf("target_status_code:%s", metric.TargetStatusCode),
-		fmt.Sprintf("ip_address:%s", p.loadBalancerIpAddress(s3ObjectKey)),
-	}
-	for _, tag := range p.customTags {
-		tags = append(tags, fmt.Sprintf("%s:%s", tag.Name, tag.Key()))
-	}
-	series.SetTags(tags)
+	series.SetUnit(s.Unit)
+	series.SetTags(s.TagStrings())
 	return *series
 }
 
-func (p *MetricsSubmitter) targetProcessingTime(metric *Metric, s3ObjectKey string) ([]datadogV1.DistributionPointsSeries, error) {
-	seriesSlice := make([]datadogV1.DistributionPointsSeries, 1)
-	points := make([][]datadogV1.DistributionPointItem, 0, len(metric.TargetProcessingTimesMap))
-
-	for timestamp, times := range metric.TargetProcessingTimesMap {
+func (p *MetricsSubmitter) distributionPointsSeries(s Series) datadogV1.DistributionPointsSeries {
+	points := make([][]datadogV1.DistributionPointItem, 0, len(s.Points))
+	for _, point := range s.Points {
 		points = append(points, []datadogV1.DistributionPointItem{
-			{DistributionPointTimestamp: timestamp.PtrFloat64()},
-			{DistributionPointData: times.Float64()},
+			{DistributionPointTimestamp: point.Timestamp.PtrFloat64()},
+			{DistributionPointData: &point.Values},
 		})
 	}
-
-	series := datadogV1.NewDistributionPointsSeries(p.targetProcessingTimeMetricName, points)
-	tags := []string{
-		fmt.Sprintf("elb:%s", metric.Elb),
-		fmt.Sprintf("target_group_arn:%s", metric.TargetGroupArn),
-		fmt.Sprintf("path:%s", metric.Path),
-		fmt.Sprintf("method:%s", metric.Method),
-		fmt.Sprintf("elb_status_code:%s", metric.ElbStatusCode),
-		fmt.Sprintf("target_status_code:%s", metric.TargetStatusCode),
-		fmt.Sprintf("target_status_code_group:%s", metric.TargetStatusCodeGroup()),
-		fmt.Sprintf("ip_address:%s", p.loadBalancerIpAddress(s3ObjectKey)),
-	}
-	for _, tag := range p.customTags {
-		tags = append(tags, fmt.Sprintf("%s:%s", tag.Name, tag.Key()))
-	}
-	series.SetTags(tags)
-	seriesSlice[0] = *series
-	return seriesSlice, nil
-}
-
-func (p *MetricsSubmitter) loadBalancerIpAddress(s string) string {
-	sl := strings.Split(s, "/")
-	return strings.Split(sl[len(sl)-1], "_")[5]
+	series := datadogV1.NewDistributionPointsSeries(s.Name, points)
+	series.SetTags(s.TagStrings())
+	return *series
 }
@@ -1,54 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
-func TestMetricsSubmitter_loadBalancerIpAddress(t *testing.T) {
-	type args struct {
-		s string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{
-			name: "with prefix",
-			args: args{
-				s: "s3://my-bucket/prefix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2016/05/01/123456789012_elasticloadbalancing_us-east-2_net.app.my-loadbalancer.1234567890abcdef_20140215T2340Z_172.160.001.192_20sg8hgm.log.gz",
-			},
-			want: "172.160.001.192",
-		},
-		{
-			name: "with prefix includes underscore",
-			args: args{
-				s: "s3://my-bucket/pre_fix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2016/05/01/123456789012_elasticloadbalancing_us-east-2_net.app.my-loadbalancer.1234567890abcdef_20140215T2340Z_172.160.001.192_20sg8hgm.log.gz",
-			},
-			want: "172.160.001.192",
-		},
-		{
-			name: "without prefix",
-			args: args{
-				s: "s3://my-bucket/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2016/05/01/123456789012_elasticloadbalancing_us-east-2_net.app.my-loadbalancer.1234567890abcdef_20140215T2340Z_172.160.001.192_20sg8hgm.log.gz",
-			},
-			want: "172.160.001.192",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			p := &MetricsSubmitter{}
-			if got := p.loadBalancerIpAddress(tt.args.s); got != tt.want {
-				t.Errorf("loadBalancerIpAddress() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
-func TestMetricsSubmitter_targetProcessingTime(t *testing.T) {
+func TestMetricsSubmitter_distributionPointsSeries(t *testing.T) {
 	var typeVar datadogV1.DistributionPointsType = datadogV1.DISTRIBUTIONPOINTSTYPE_DISTRIBUTION
 	type fields struct {
 		RequestCountMetricName         string
@@ -59,11 +23,10 @@ func TestMetricsSubmitter_targetProcessingTime(t *testing.T) {
 		metric *Metric
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    []datadogV1.DistributionPointsSeries
-		wantErr bool
+		name   string
+		fields fields
+		args   args
+		want   []datadogV1.DistributionPointsSeries
 	}{
 		{
 			name: "",
@@ -82,6 +45,7 @@ func TestMetricsSubmitter_targetProcessingTime(t *testing.T) {
 					TargetStatusCode: "200",
 					Elb:              "elb",
 					TargetGroupArn:   "arn",
+					IpAddress:        "172.160.001.192",
 				},
 			},
 			want: []datadogV1.DistributionPointsSeries{
@@ -110,7 +74,6 @@ func TestMetricsSubmitter_targetProcessingTime(t *testing.T) {
 					Type: &typeVar,
 				},
 			},
-			wantErr: false,
 		},
 		{
 			name: "TargetStatusCode is -",
@@ -129,6 +92,7 @@ func TestMetricsSubmitter_targetProcessingTime(t *testing.T) {
 					TargetStatusCode: "-",
 					Elb:              "elb",
 					TargetGroupArn:   "arn",
+					IpAddress:        "172.160.001.192",
 				},
 			},
 			want: []datadogV1.DistributionPointsSeries{
@@ -157,24 +121,80 @@ func TestMetricsSubmitter_targetProcessingTime(t *testing.T) {
 					Type: &typeVar,
 				},
 			},
-			wantErr: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			p := &MetricsSubmitter{
-				requestCountMetricName:         tt.fields.RequestCountMetricName,
-				targetProcessingTimeMetricName: tt.fields.TargetProcessingTimeMetricName,
-				customTags:                     tt.fields.CustomTags,
-			}
-			got, err := p.targetProcessingTime(tt.args.metric, "s3://my-bucket/my-prefix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2022/05/01/123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.1234567890abcdef_20220215T2340Z_172.160.001.192_20sg8hgm.log.gz")
-			if (err != nil) != tt.wantErr {
-				t.Errorf("targetProcessingTime() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+			b := NewSeriesBuilder(&Config{
+				RequestCountMetricName:         tt.fields.RequestCountMetricName,
+				TargetProcessingTimeMetricName: tt.fields.TargetProcessingTimeMetricName,
+				CustomTags:                     tt.fields.CustomTags,
+			})
+			p := &MetricsSubmitter{}
+			got := []datadogV1.DistributionPointsSeries{p.distributionPointsSeries(b.targetProcessingTimeSeries(tt.args.metric))}
 			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("targetProcessingTime() got = %v, want %v", got, tt.want)
+				t.Errorf("distributionPointsSeries() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestMetricsSubmitter_Submit_concurrency(t *testing.T) {
+	const concurrency = 3
+
+	var mu sync.Mutex
+	inFlight, maxInFlight, requests := 0, 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		requests++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	p := NewMetricsSubmitter(&Config{
+		MaxSeriesPerRequest: 1,
+		SubmitConcurrency:   concurrency,
+	})
+	p.apiConfiguration.Servers = datadog.ServerConfigurations{{URL: server.URL}}
+
+	metrics := map[string]*Metric{}
+	for i := range 10 {
+		metrics[fmt.Sprintf("key%d", i)] = &Metric{
+			RequestCountMap:          map[Timestamp]RequestCount{Timestamp(1): 1},
+			TargetProcessingTimesMap: map[Timestamp]TargetProcessingTimes{Timestamp(1): {0.1}},
+			Method:                   "GET",
+			Path:                     fmt.Sprintf("/%d", i),
+			ElbStatusCode:            "200",
+			TargetStatusCode:         "200",
+			Elb:                      "elb",
+			TargetGroupArn:           "arn",
+			IpAddress:                "172.160.001.192",
+		}
+	}
+	series := NewSeriesBuilder(&Config{
+		RequestCountMetricName:         "request_count",
+		TargetProcessingTimeMetricName: "target_processing_time",
+	}).Build(metrics)
+
+	err := p.Submit(series)
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if requests != 20 {
+		t.Errorf("Submit() sent %d requests, want %d", requests, 20)
+	}
+	if maxInFlight > concurrency {
+		t.Errorf("Submit() sent %d requests concurrently, want at most %d", maxInFlight, concurrency)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NlbLogRecord is NLB's access log record, which is written only for TLS listeners.
+// see: https://docs.aws.amazon.com/elasticloadbalancing/latest/network/load-balancer-access-logs.html
+type NlbLogRecord struct {
+	Type            string
+	Version         string
+	Time            time.Time
+	Elb             string
+	Listener        string
+	ClientPort      string
+	DestinationPort string
+	// ConnectionTime is milliseconds from the beginning to the end of the connection.
+	ConnectionTime int
+	// TlsHandshakeTime is milliseconds to complete TLS handshake, which is -1 when the handshake didn't complete.
+	TlsHandshakeTime          int
+	ReceivedBytes             int
+	SentBytes                 int
+	IncomingTlsAlert          string
+	ChosenCertArn             string
+	ChosenCertSerial          string
+	TlsCipher                 string
+	TlsProtocolVersion        string
+	TlsNamedGroup             string
+	DomainName                string
+	AlpnFeProtocol            string
+	AlpnBeProtocol            string
+	AlpnClientPreferenceList  string
+	TlsConnectionCreationTime string
+}
+
+// nlbLogFieldCount is the number of fields of NLB log record of version 2.0.
+const nlbLogFieldCount = 22
+
+// nlbLogTimeLayout is the layout of time of NLB log record, which is in UTC without time zone.
+const nlbLogTimeLayout = "2006-01-02T15:04:05"
+
+// parseNlbLog parses NLB's access log record whose fields are separated by space. Fields after known fields are ignored.
+func parseNlbLog(line string) (*NlbLogRecord, error) {
+	values := strings.SplitN(line, " ", nlbLogFieldCount+1)
+	if len(values) < nlbLogFieldCount {
+		return nil, fmt.Errorf("too few fields in nlb log record: %s", line)
+	}
+
+	ts, err := time.Parse(nlbLogTimeLayout, values[2])
+	if err != nil {
+		return nil, err
+	}
+	connectionTime, err := strconv.Atoi(values[7])
+	if err != nil {
+		return nil, err
+	}
+	tlsHandshakeTime := -1
+	if values[8] != "-" {
+		tlsHandshakeTime, err = strconv.Atoi(values[8])
+		if err != nil {
+			return nil, err
+		}
+	}
+	receivedBytes, err := strconv.Atoi(values[9])
+	if err != nil {
+		return nil, err
+	}
+	sentBytes, err := strconv.Atoi(values[10])
+	if err != nil {
+		return nil, err
+	}
+	return &NlbLogRecord{
+		Type:                      values[0],
+		Version:                   values[1],
+		Time:                      ts,
+		Elb:                       values[3],
+		Listener:                  values[4],
+		ClientPort:                values[5],
+		DestinationPort:           values[6],
+		ConnectionTime:            connectionTime,
+		TlsHandshakeTime:          tlsHandshakeTime,
+		ReceivedBytes:             receivedBytes,
+		SentBytes:                 sentBytes,
+		IncomingTlsAlert:          values[11],
+		ChosenCertArn:             values[12],
+		ChosenCertSerial:          values[13],
+		TlsCipher:                 values[14],
+		TlsProtocolVersion:        values[15],
+		TlsNamedGroup:             values[16],
+		DomainName:                values[17],
+		AlpnFeProtocol:            values[18],
+		AlpnBeProtocol:            values[19],
+		AlpnClientPreferenceList:  values[20],
+		TlsConnectionCreationTime: values[21],
+	}, nil
+}
+
+func (r *NlbLogRecord) Timestamp() Timestamp {
+	return Timestamp(r.Time.Unix())
+}
+
+func (r *NlbLogRecord) MetricKey() string {
+	return fmt.Sprintf("%s_%s_%s_%s", r.Elb, r.Listener, r.TlsProtocolVersion, r.TlsCipher)
+}
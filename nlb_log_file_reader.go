@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// NlbMetric is metrics of connections of NLB aggregated by listener, TLS protocol version and cipher.
+type NlbMetric struct {
+	ConnectionCountMap map[Timestamp]int
+	// TlsHandshakeTimesMap is seconds of completed TLS handshakes.
+	TlsHandshakeTimesMap map[Timestamp][]float64
+	ReceivedBytesMap     map[Timestamp]int
+	SentBytesMap         map[Timestamp]int
+	Elb                  string
+	Listener             string
+	TlsProtocolVersion   string
+	TlsCipher            string
+}
+
+// ReadNlb reads NLB log file and aggregates metrics of connections.
+// Malformed lines are handled in the same way as Read.
+func (p *LogFileReader) ReadNlb(r io.Reader) (*ReadResult, error) {
+	scanner := bufio.NewScanner(r)
+
+	result := &ReadResult{NlbMetrics: map[string]*NlbMetric{}}
+	for scanner.Scan() {
+		text := scanner.Text()
+		result.Lines++
+		r, err := parseNlbLog(text)
+		if err != nil {
+			if err := p.skipMalformedLine(result, text, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		metricKey := r.MetricKey()
+		metric, ok := result.NlbMetrics[metricKey]
+		if !ok {
+			metric = &NlbMetric{
+				ConnectionCountMap:   map[Timestamp]int{},
+				TlsHandshakeTimesMap: map[Timestamp][]float64{},
+				ReceivedBytesMap:     map[Timestamp]int{},
+				SentBytesMap:         map[Timestamp]int{},
+				Elb:                  r.Elb,
+				Listener:             r.Listener,
+				TlsProtocolVersion:   r.TlsProtocolVersion,
+				TlsCipher:            r.TlsCipher,
+			}
+			result.NlbMetrics[metricKey] = metric
+		}
+
+		timestamp := r.Timestamp()
+		metric.ConnectionCountMap[timestamp]++
+		metric.ReceivedBytesMap[timestamp] += r.ReceivedBytes
+		metric.SentBytesMap[timestamp] += r.SentBytes
+		// TlsHandshakeTime is -1 when the handshake didn't complete, which is counted only as a connection.
+		if r.TlsHandshakeTime >= 0 {
+			metric.TlsHandshakeTimesMap[timestamp] = append(metric.TlsHandshakeTimesMap[timestamp], float64(r.TlsHandshakeTime)/1000)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.checkMalformedLines(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MergeNlbMetrics merges metrics of src into dst in the same way as MergeMetrics.
+func MergeNlbMetrics(dst map[string]*NlbMetric, src map[string]*NlbMetric) {
+	for key, metric := range src {
+		d, ok := dst[key]
+		if !ok {
+			dst[key] = metric
+			continue
+		}
+		for timestamp, count := range metric.ConnectionCountMap {
+			d.ConnectionCountMap[timestamp] += count
+		}
+		for timestamp, times := range metric.TlsHandshakeTimesMap {
+			d.TlsHandshakeTimesMap[timestamp] = append(d.TlsHandshakeTimesMap[timestamp], times...)
+		}
+		for timestamp, bytes := range metric.ReceivedBytesMap {
+			d.ReceivedBytesMap[timestamp] += bytes
+		}
+		for timestamp, bytes := range metric.SentBytesMap {
+			d.SentBytesMap[timestamp] += bytes
+		}
+	}
+}
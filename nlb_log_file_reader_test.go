@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLogFileReader_ReadNlb(t *testing.T) {
+	reader := NewLogFileReader(&Config{MalformedLines: MalformedLinesConfig{Policy: "skip"}})
+	lines := []string{exampleNlbEntry, exampleNlbIncompleteHandshakeEntry, exampleNlbEntry, "garbage"}
+	got, err := reader.ReadNlb(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("ReadNlb() error = %v", err)
+	}
+	if got.Lines != 4 || got.MalformedLines != 1 {
+		t.Errorf("ReadNlb() reads %d lines with %d malformed lines, want 4 lines with 1", got.Lines, got.MalformedLines)
+	}
+	if len(got.NlbMetrics) != 2 {
+		t.Fatalf("ReadNlb() returns %d metrics, want 2", len(got.NlbMetrics))
+	}
+
+	timestamp := Timestamp(1545274780)
+	want := &NlbMetric{
+		ConnectionCountMap:   map[Timestamp]int{timestamp: 2},
+		TlsHandshakeTimesMap: map[Timestamp][]float64{timestamp: {0.002, 0.002}},
+		ReceivedBytesMap:     map[Timestamp]int{timestamp: 196},
+		SentBytesMap:         map[Timestamp]int{timestamp: 492},
+		Elb:                  "net/my-network-loadbalancer/c6e77e28c25b2234",
+		Listener:             "g3d4b5e8bb8464cd",
+		TlsProtocolVersion:   "tlsv12",
+		TlsCipher:            "ECDHE-RSA-AES128-SHA",
+	}
+	if metric := got.NlbMetrics[want.Elb+"_g3d4b5e8bb8464cd_tlsv12_ECDHE-RSA-AES128-SHA"]; !reflect.DeepEqual(metric, want) {
+		t.Errorf("ReadNlb() got = %+v, want %+v", metric, want)
+	}
+
+	incomplete := got.NlbMetrics[want.Elb+"_g3d4b5e8bb8464cd_-_-"]
+	if incomplete == nil || incomplete.ConnectionCountMap[timestamp] != 1 || len(incomplete.TlsHandshakeTimesMap) != 0 {
+		t.Errorf("ReadNlb() got = %+v for incomplete handshake", incomplete)
+	}
+}
+
+func TestLogFileReader_ReadNlb_malformedLine(t *testing.T) {
+	reader := NewLogFileReader(&Config{})
+	if _, err := reader.ReadNlb(strings.NewReader(exampleNlbEntry + "\ngarbage")); err == nil {
+		t.Error("ReadNlb() error = nil")
+	}
+}
+
+func TestMergeNlbMetrics(t *testing.T) {
+	dst := map[string]*NlbMetric{
+		"a": {
+			ConnectionCountMap:   map[Timestamp]int{1: 1},
+			TlsHandshakeTimesMap: map[Timestamp][]float64{1: {0.1}},
+			ReceivedBytesMap:     map[Timestamp]int{1: 10},
+			SentBytesMap:         map[Timestamp]int{1: 20},
+		},
+	}
+	src := map[string]*NlbMetric{
+		"a": {
+			ConnectionCountMap:   map[Timestamp]int{1: 2, 2: 1},
+			TlsHandshakeTimesMap: map[Timestamp][]float64{1: {0.2}},
+			ReceivedBytesMap:     map[Timestamp]int{1: 30, 2: 5},
+			SentBytesMap:         map[Timestamp]int{1: 40, 2: 6},
+		},
+		"b": {ConnectionCountMap: map[Timestamp]int{1: 1}},
+	}
+	MergeNlbMetrics(dst, src)
+
+	if len(dst) != 2 || dst["b"] != src["b"] {
+		t.Fatalf("MergeNlbMetrics() = %v", dst)
+	}
+	want := &NlbMetric{
+		ConnectionCountMap:   map[Timestamp]int{1: 3, 2: 1},
+		TlsHandshakeTimesMap: map[Timestamp][]float64{1: {0.1, 0.2}},
+		ReceivedBytesMap:     map[Timestamp]int{1: 40, 2: 5},
+		SentBytesMap:         map[Timestamp]int{1: 60, 2: 6},
+	}
+	if !reflect.DeepEqual(dst["a"], want) {
+		t.Errorf("MergeNlbMetrics() got = %+v, want %+v", dst["a"], want)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// this is NLB's access log record: https://docs.aws.amazon.com/elasticloadbalancing/latest/network/load-balancer-access-logs.html
+var (
+	exampleNlbEntry                    = `tls 2.0 2018-12-20T02:59:40 net/my-network-loadbalancer/c6e77e28c25b2234 g3d4b5e8bb8464cd 72.21.218.154:51341 172.100.100.185:443 5 2 98 246 - arn:aws:acm:us-east-2:671290407336:certificate/2a108f19-aded-46b0-8493-c63eb1ef4a99 - ECDHE-RSA-AES128-SHA tlsv12 - my-network-loadbalancer-c6e77e28c25b2234.elb.us-east-2.amazonaws.com h2 h2 "h2","http/1.1" 2018-12-20T02:59:38`
+	exampleNlbIncompleteHandshakeEntry = `tls 2.0 2018-12-20T02:59:40 net/my-network-loadbalancer/c6e77e28c25b2234 g3d4b5e8bb8464cd 72.21.218.154:51342 172.100.100.185:443 3 - 0 0 UnknownCA - - - - - - - - - -`
+)
+
+func Test_parseNlbLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    *NlbLogRecord
+		wantErr bool
+	}{
+		{
+			name: "Example entry of document",
+			line: exampleNlbEntry,
+			want: &NlbLogRecord{
+				Type:                      "tls",
+				Version:                   "2.0",
+				Time:                      time.Date(2018, 12, 20, 2, 59, 40, 0, time.UTC),
+				Elb:                       "net/my-network-loadbalancer/c6e77e28c25b2234",
+				Listener:                  "g3d4b5e8bb8464cd",
+				ClientPort:                "72.21.218.154:51341",
+				DestinationPort:           "172.100.100.185:443",
+				ConnectionTime:            5,
+				TlsHandshakeTime:          2,
+				ReceivedBytes:             98,
+				SentBytes:                 246,
+				IncomingTlsAlert:          "-",
+				ChosenCertArn:             "arn:aws:acm:us-east-2:671290407336:certificate/2a108f19-aded-46b0-8493-c63eb1ef4a99",
+				ChosenCertSerial:          "-",
+				TlsCipher:                 "ECDHE-RSA-AES128-SHA",
+				TlsProtocolVersion:        "tlsv12",
+				TlsNamedGroup:             "-",
+				DomainName:                "my-network-loadbalancer-c6e77e28c25b2234.elb.us-east-2.amazonaws.com",
+				AlpnFeProtocol:            "h2",
+				AlpnBeProtocol:            "h2",
+				AlpnClientPreferenceList:  `"h2","http/1.1"`,
+				TlsConnectionCreationTime: "2018-12-20T02:59:38",
+			},
+		},
+		{
+			name: "Entry of incomplete TLS handshake",
+			line: exampleNlbIncompleteHandshakeEntry,
+			want: &NlbLogRecord{
+				Type:                      "tls",
+				Version:                   "2.0",
+				Time:                      time.Date(2018, 12, 20, 2, 59, 40, 0, time.UTC),
+				Elb:                       "net/my-network-loadbalancer/c6e77e28c25b2234",
+				Listener:                  "g3d4b5e8bb8464cd",
+				ClientPort:                "72.21.218.154:51342",
+				DestinationPort:           "172.100.100.185:443",
+				ConnectionTime:            3,
+				TlsHandshakeTime:          -1,
+				ReceivedBytes:             0,
+				SentBytes:                 0,
+				IncomingTlsAlert:          "UnknownCA",
+				ChosenCertArn:             "-",
+				ChosenCertSerial:          "-",
+				TlsCipher:                 "-",
+				TlsProtocolVersion:        "-",
+				TlsNamedGroup:             "-",
+				DomainName:                "-",
+				AlpnFeProtocol:            "-",
+				AlpnBeProtocol:            "-",
+				AlpnClientPreferenceList:  "-",
+				TlsConnectionCreationTime: "-",
+			},
+		},
+		{
+			name:    "too few fields",
+			line:    strings.Join(strings.Fields(exampleNlbEntry)[:21], " "),
+			wantErr: true,
+		},
+		{
+			name:    "invalid handshake time",
+			line:    strings.Replace(exampleNlbEntry, " 5 2 98 246 ", " 5 fast 98 246 ", 1),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNlbLog(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNlbLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNlbLog() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseNlbLog_trailingFields(t *testing.T) {
+	got, err := parseNlbLog(exampleNlbEntry + " unknown fields")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TlsConnectionCreationTime != "2018-12-20T02:59:38" {
+		t.Errorf("TlsConnectionCreationTime = %v", got.TlsConnectionCreationTime)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	OtlpEncodingProtobuf = "protobuf"
+	OtlpEncodingJson     = "json"
+
+	OtlpCompressionNone = "none"
+	OtlpCompressionGzip = "gzip"
+)
+
+const (
+	// defaultOtlpMaxBuckets is used when otlp.max_buckets is not configured. This is same as the default of OpenTelemetry SDK.
+	defaultOtlpMaxBuckets = 160
+	// defaultOtlpMaxSeriesPerRequest is used when otlp.max_series_per_request is not configured.
+	defaultOtlpMaxSeriesPerRequest = 500
+	// defaultOtlpTimeout is used when otlp.timeout is not configured.
+	defaultOtlpTimeout = 30 * time.Second
+
+	// otlpMaxScale is the scale of exponential histogram before downscaling to fit in max buckets.
+	otlpMaxScale = 20
+)
+
+// OtlpSink is the Sink exporting series to OpenTelemetry Collector via OTLP/HTTP.
+// see: https://opentelemetry.io/docs/specs/otlp/#otlphttp
+//
+// Count series are exported as delta monotonic Sum, and distribution series are exported as delta ExponentialHistogram.
+// Each data point covers one second from its timestamp. The value of `elb` tag is also set to resource attributes.
+type OtlpSink struct {
+	endpoint            string
+	encoding            string
+	compression         string
+	headers             map[string]string
+	maxBuckets          int
+	maxSeriesPerRequest int
+	submitConcurrency   int
+	retrier             *Retrier
+	httpClient          *http.Client
+}
+
+func NewOtlpSink(config *Config) (*OtlpSink, error) {
+	c := config.Otlp
+	if c.Endpoint == "" {
+		return nil, fmt.Errorf("otlp.endpoint is required")
+	}
+	encoding := c.Encoding
+	switch encoding {
+	case "":
+		encoding = OtlpEncodingProtobuf
+	case OtlpEncodingProtobuf, OtlpEncodingJson:
+	default:
+		return nil, fmt.Errorf("unknown otlp.encoding: %s", encoding)
+	}
+	compression := c.Compression
+	switch compression {
+	case "":
+		compression = OtlpCompressionNone
+	case OtlpCompressionNone, OtlpCompressionGzip:
+	default:
+		return nil, fmt.Errorf("unknown otlp.compression: %s", compression)
+	}
+	maxBuckets := c.MaxBuckets
+	if maxBuckets == 0 {
+		maxBuckets = defaultOtlpMaxBuckets
+	}
+	maxSeriesPerRequest := c.MaxSeriesPerRequest
+	if maxSeriesPerRequest == 0 {
+		maxSeriesPerRequest = defaultOtlpMaxSeriesPerRequest
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultOtlpTimeout
+	}
+	submitConcurrency := config.SubmitConcurrency
+	if submitConcurrency == 0 {
+		submitConcurrency = defaultSubmitConcurrency
+	}
+	return &OtlpSink{
+		endpoint:            c.Endpoint,
+		encoding:            encoding,
+		compression:         compression,
+		headers:             c.Headers,
+		maxBuckets:          maxBuckets,
+		maxSeriesPerRequest: maxSeriesPerRequest,
+		submitConcurrency:   submitConcurrency,
+		retrier:             NewRetrier(config.SubmitRetry),
+		httpClient:          &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (s *OtlpSink) Submit(series []Series) error {
+	var eg errgroup.Group
+	eg.SetLimit(s.submitConcurrency)
+	for batch := range slices.Chunk(series, s.maxSeriesPerRequest) {
+		eg.Go(func() error {
+			body, err := s.encode(s.metricsData(batch))
+			if err != nil {
+				return err
+			}
+			return s.retrier.Do(context.Background(), "otlp export", func() (*http.Response, error) {
+				return s.post(body)
+			})
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return fmt.Errorf("otlp export fails: %w", err)
+	}
+	return nil
+}
+
+// encode returns the body of request. ExportMetricsServiceRequest has the same fields as MetricsData.
+func (s *OtlpSink) encode(data *metricspb.MetricsData) ([]byte, error) {
+	var buf []byte
+	var err error
+	switch s.encoding {
+	case OtlpEncodingJson:
+		// Enum values must be encoded as integer in OTLP/JSON.
+		buf, err = protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(data)
+	default:
+		buf, err = proto.Marshal(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.compression != OtlpCompressionGzip {
+		return buf, nil
+	}
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (s *OtlpSink) post(body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.encoding == OtlpEncodingJson {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	if s.compression == OtlpCompressionGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("User-Agent", "send-alb-metrics-to-datadog")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		buf, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(buf)))
+	}
+	return resp, nil
+}
+
+// metricsData groups series by load balancer into ResourceMetrics.
+func (s *OtlpSink) metricsData(series []Series) *metricspb.MetricsData {
+	data := &metricspb.MetricsData{}
+	scopes := map[string]*metricspb.ScopeMetrics{}
+	for _, se := range series {
+		elb := se.TagValue("elb")
+		scope, ok := scopes[elb]
+		if !ok {
+			scope = &metricspb.ScopeMetrics{
+				Scope: &commonpb.InstrumentationScope{Name: "send-alb-metrics-to-datadog"},
+			}
+			scopes[elb] = scope
+			data.ResourceMetrics = append(data.ResourceMetrics, &metricspb.ResourceMetrics{
+				Resource: &resourcepb.Resource{
+					Attributes: []*commonpb.KeyValue{
+						otlpStringAttribute("cloud.provider", "aws"),
+						otlpStringAttribute("elb", elb),
+					},
+				},
+				ScopeMetrics: []*metricspb.ScopeMetrics{scope},
+			})
+		}
+
+		switch se.Type {
+		case SeriesTypeCount:
+			scope.Metrics = append(scope.Metrics, s.sumMetric(se))
+		case SeriesTypeDistribution:
+			scope.Metrics = append(scope.Metrics, s.exponentialHistogramMetric(se))
+		}
+	}
+	return data
+}
+
+func (s *OtlpSink) sumMetric(se Series) *metricspb.Metric {
+	attributes := otlpAttributes(se.Tags)
+	dataPoints := make([]*metricspb.NumberDataPoint, 0, len(se.Points))
+	for _, point := range se.Points {
+		start, end := otlpTimeRange(point.Timestamp)
+		dataPoints = append(dataPoints, &metricspb.NumberDataPoint{
+			Attributes:        attributes,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      end,
+			Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: point.Value},
+		})
+	}
+	return &metricspb.Metric{
+		Name: se.Name,
+		Unit: otlpUnit(se.Unit),
+		Data: &metricspb.Metric_Sum{
+			Sum: &metricspb.Sum{
+				DataPoints:             dataPoints,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				IsMonotonic:            true,
+			},
+		},
+	}
+}
+
+func (s *OtlpSink) exponentialHistogramMetric(se Series) *metricspb.Metric {
+	attributes := otlpAttributes(se.Tags)
+	dataPoints := make([]*metricspb.ExponentialHistogramDataPoint, 0, len(se.Points))
+	for _, point := range se.Points {
+		dataPoint := newExponentialHistogramDataPoint(point.Values, s.maxBuckets)
+		dataPoint.Attributes = attributes
+		dataPoint.StartTimeUnixNano, dataPoint.TimeUnixNano = otlpTimeRange(point.Timestamp)
+		dataPoints = append(dataPoints, dataPoint)
+	}
+	return &metricspb.Metric{
+		Name: se.Name,
+		Unit: otlpUnit(se.Unit),
+		Data: &metricspb.Metric_ExponentialHistogram{
+			ExponentialHistogram: &metricspb.ExponentialHistogram{
+				DataPoints:             dataPoints,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			},
+		},
+	}
+}
+
+// newExponentialHistogramDataPoint returns the data point with the largest scale such that the number of buckets doesn't exceed maxBuckets.
+// see: https://opentelemetry.io/docs/specs/otel/metrics/data-model/#exponentialhistogram
+func newExponentialHistogramDataPoint(values []float64, maxBuckets int) *metricspb.ExponentialHistogramDataPoint {
+	dataPoint := &metricspb.ExponentialHistogramDataPoint{Count: uint64(len(values))}
+	if len(values) == 0 {
+		return dataPoint
+	}
+
+	var sum float64
+	var positive, negative []int64
+	for _, v := range values {
+		sum += v
+		switch {
+		case v > 0:
+			positive = append(positive, exponentialHistogramIndex(v, otlpMaxScale))
+		case v < 0:
+			negative = append(negative, exponentialHistogramIndex(-v, otlpMaxScale))
+		default:
+			dataPoint.ZeroCount++
+		}
+	}
+	minValue, maxValue := slices.Min(values), slices.Max(values)
+	dataPoint.Sum = &sum
+	dataPoint.Min = &minValue
+	dataPoint.Max = &maxValue
+
+	// Index at scale-1 is index at scale >> 1, so decrease scale until buckets of both signs fit.
+	shift := 0
+	for ; shift < otlpMaxScale+10; shift++ {
+		if bucketsLen(positive, shift) <= maxBuckets && bucketsLen(negative, shift) <= maxBuckets {
+			break
+		}
+	}
+	dataPoint.Scale = int32(otlpMaxScale - shift)
+	dataPoint.Positive = exponentialHistogramBuckets(positive, shift)
+	dataPoint.Negative = exponentialHistogramBuckets(negative, shift)
+	return dataPoint
+}
+
+func bucketsLen(indices []int64, shift int) int {
+	if len(indices) == 0 {
+		return 0
+	}
+	return int(slices.Max(indices)>>shift - slices.Min(indices)>>shift + 1)
+}
+
+func exponentialHistogramBuckets(indices []int64, shift int) *metricspb.ExponentialHistogramDataPoint_Buckets {
+	if len(indices) == 0 {
+		return &metricspb.ExponentialHistogramDataPoint_Buckets{}
+	}
+	offset := slices.Min(indices) >> shift
+	counts := make([]uint64, bucketsLen(indices, shift))
+	for _, i := range indices {
+		counts[i>>shift-offset]++
+	}
+	return &metricspb.ExponentialHistogramDataPoint_Buckets{Offset: int32(offset), BucketCounts: counts}
+}
+
+// exponentialHistogramIndex returns the index of bucket which satisfies base^index < v <= base^(index+1) where base is 2^(2^-scale).
+func exponentialHistogramIndex(v float64, scale int) int64 {
+	frac, exp := math.Frexp(v)
+	// v is exactly a power of two, which is the upper boundary of the bucket.
+	if frac == 0.5 {
+		return int64(exp-1)<<scale - 1
+	}
+	return int64(math.Ceil(math.Log2(v)*math.Ldexp(1, scale))) - 1
+}
+
+// otlpTimeRange returns the start and end time of data point in nanoseconds.
+func otlpTimeRange(ts Timestamp) (uint64, uint64) {
+	start := time.Unix(int64(ts), 0)
+	return uint64(start.UnixNano()), uint64(start.Add(time.Second).UnixNano())
+}
+
+func otlpAttributes(tags []SeriesTag) []*commonpb.KeyValue {
+	attributes := make([]*commonpb.KeyValue, 0, len(tags))
+	for _, tag := range tags {
+		attributes = append(attributes, otlpStringAttribute(tag.Name, tag.Value))
+	}
+	return attributes
+}
+
+func otlpStringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// otlpUnit returns the unit in UCUM as recommended by OpenTelemetry.
+func otlpUnit(unit string) string {
+	switch unit {
+	case "second":
+		return "s"
+	case "byte":
+		return "By"
+	case "":
+		return ""
+	}
+	return "{" + unit + "}"
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOtlpSink_Submit(t *testing.T) {
+	tests := []struct {
+		name            string
+		encoding        string
+		compression     string
+		wantContentType string
+	}{
+		{name: "protobuf", encoding: "", compression: "", wantContentType: "application/x-protobuf"},
+		{name: "json", encoding: "json", compression: "none", wantContentType: "application/json"},
+		{name: "protobuf with gzip", encoding: "protobuf", compression: "gzip", wantContentType: "application/x-protobuf"},
+		{name: "json with gzip", encoding: "json", compression: "gzip", wantContentType: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &metricspb.MetricsData{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != tt.wantContentType {
+					t.Errorf("unexpected Content-Type: %s", r.Header.Get("Content-Type"))
+				}
+				var body io.Reader = r.Body
+				if r.Header.Get("Content-Encoding") == "gzip" {
+					zr, err := gzip.NewReader(r.Body)
+					if err != nil {
+						t.Fatal(err)
+					}
+					body = zr
+				} else if tt.compression == "gzip" {
+					t.Errorf("Content-Encoding is not gzip")
+				}
+				buf, err := io.ReadAll(body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tt.encoding == "json" {
+					err = protojson.Unmarshal(buf, got)
+				} else {
+					err = proto.Unmarshal(buf, got)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}))
+			defer server.Close()
+
+			sink, err := NewOtlpSink(&Config{
+				Otlp: OtlpConfig{Endpoint: server.URL, Encoding: tt.encoding, Compression: tt.compression},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tags := []SeriesTag{{Name: "elb", Value: "app/my-loadbalancer/50dc6c495c0c9188"}, {Name: "path", Value: "/"}}
+			err = sink.Submit([]Series{
+				{
+					Name:   "request_count",
+					Type:   SeriesTypeCount,
+					Unit:   "request",
+					Tags:   tags,
+					Points: []SeriesPoint{{Timestamp: 1, Value: 3}},
+				},
+				{
+					Name:   "target_processing_time",
+					Type:   SeriesTypeDistribution,
+					Unit:   "second",
+					Tags:   tags,
+					Points: []SeriesPoint{{Timestamp: 1, Values: []float64{1, 2, 4}}},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Submit() error = %v", err)
+			}
+
+			if len(got.ResourceMetrics) != 1 {
+				t.Fatalf("got %d resource metrics, want 1", len(got.ResourceMetrics))
+			}
+			resource := got.ResourceMetrics[0]
+			if attr := resource.Resource.Attributes[1]; attr.Key != "elb" || attr.Value.GetStringValue() != "app/my-loadbalancer/50dc6c495c0c9188" {
+				t.Errorf("unexpected resource attribute %v", attr)
+			}
+			metrics := resource.ScopeMetrics[0].Metrics
+			if len(metrics) != 2 {
+				t.Fatalf("got %d metrics, want 2", len(metrics))
+			}
+
+			sum := metrics[0].GetSum()
+			if metrics[0].Name != "request_count" || metrics[0].Unit != "{request}" || sum == nil {
+				t.Fatalf("unexpected metric %v", metrics[0])
+			}
+			if !sum.IsMonotonic || sum.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+				t.Errorf("unexpected sum %v", sum)
+			}
+			point := sum.DataPoints[0]
+			if point.GetAsDouble() != 3 || point.StartTimeUnixNano != 1e9 || point.TimeUnixNano != 2e9 {
+				t.Errorf("unexpected data point %v", point)
+			}
+			if len(point.Attributes) != 2 || point.Attributes[1].Key != "path" || point.Attributes[1].Value.GetStringValue() != "/" {
+				t.Errorf("unexpected attributes %v", point.Attributes)
+			}
+
+			histogram := metrics[1].GetExponentialHistogram()
+			if metrics[1].Name != "target_processing_time" || metrics[1].Unit != "s" || histogram == nil {
+				t.Fatalf("unexpected metric %v", metrics[1])
+			}
+			if histogram.AggregationTemporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+				t.Errorf("unexpected histogram %v", histogram)
+			}
+			hp := histogram.DataPoints[0]
+			if hp.Count != 3 || hp.GetSum() != 7 || hp.GetMin() != 1 || hp.GetMax() != 4 {
+				t.Errorf("unexpected data point %v", hp)
+			}
+		})
+	}
+}
+
+func Test_newExponentialHistogramDataPoint(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       []float64
+		maxBuckets   int
+		wantScale    int32
+		wantZero     uint64
+		wantPositive *metricspb.ExponentialHistogramDataPoint_Buckets
+		wantNegative *metricspb.ExponentialHistogramDataPoint_Buckets
+	}{
+		{
+			name:         "powers of two",
+			values:       []float64{1, 2, 4},
+			maxBuckets:   3,
+			wantScale:    0,
+			wantPositive: &metricspb.ExponentialHistogramDataPoint_Buckets{Offset: -1, BucketCounts: []uint64{1, 1, 1}},
+			wantNegative: &metricspb.ExponentialHistogramDataPoint_Buckets{},
+		},
+		{
+			name:         "same values",
+			values:       []float64{0.3, 0.3},
+			maxBuckets:   160,
+			wantScale:    20,
+			wantPositive: &metricspb.ExponentialHistogramDataPoint_Buckets{Offset: int32(exponentialHistogramIndex(0.3, 20)), BucketCounts: []uint64{2}},
+			wantNegative: &metricspb.ExponentialHistogramDataPoint_Buckets{},
+		},
+		{
+			name:         "zero and negative values",
+			values:       []float64{0, -1, 3},
+			maxBuckets:   2,
+			wantScale:    20,
+			wantZero:     1,
+			wantPositive: &metricspb.ExponentialHistogramDataPoint_Buckets{Offset: int32(exponentialHistogramIndex(3, 20)), BucketCounts: []uint64{1}},
+			wantNegative: &metricspb.ExponentialHistogramDataPoint_Buckets{Offset: -1, BucketCounts: []uint64{1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newExponentialHistogramDataPoint(tt.values, tt.maxBuckets)
+			if got.Scale != tt.wantScale {
+				t.Errorf("Scale = %d, want %d", got.Scale, tt.wantScale)
+			}
+			if got.ZeroCount != tt.wantZero {
+				t.Errorf("ZeroCount = %d, want %d", got.ZeroCount, tt.wantZero)
+			}
+			if got.Count != uint64(len(tt.values)) {
+				t.Errorf("Count = %d, want %d", got.Count, len(tt.values))
+			}
+			if !proto.Equal(got.Positive, tt.wantPositive) {
+				t.Errorf("Positive = %v, want %v", got.Positive, tt.wantPositive)
+			}
+			if !proto.Equal(got.Negative, tt.wantNegative) {
+				t.Errorf("Negative = %v, want %v", got.Negative, tt.wantNegative)
+			}
+		})
+	}
+}
+
+func Test_exponentialHistogramIndex(t *testing.T) {
+	tests := []struct {
+		v     float64
+		scale int
+		want  int64
+	}{
+		{v: 1, scale: 0, want: -1},
+		{v: 1.5, scale: 0, want: 0},
+		{v: 2, scale: 0, want: 0},
+		{v: 0.25, scale: 0, want: -3},
+		{v: 2, scale: 1, want: 1},
+		{v: 1.5, scale: 1, want: 1},
+		{v: 1.4, scale: 1, want: 0},
+	}
+	var got []int64
+	var want []int64
+	for _, tt := range tests {
+		got = append(got, exponentialHistogramIndex(tt.v, tt.scale))
+		want = append(want, tt.want)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exponentialHistogramIndex() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+)
+
+// payloadLimits is the size limits of a single request to Datadog API.
+type payloadLimits struct {
+	maxCompressedBytes   int
+	maxUncompressedBytes int
+}
+
+var (
+	// see: https://docs.datadoghq.com/api/latest/metrics/#submit-metrics
+	seriesPayloadLimits = payloadLimits{
+		maxCompressedBytes:   512000,
+		maxUncompressedBytes: 5242880,
+	}
+	// see: https://docs.datadoghq.com/api/latest/metrics/#submit-distribution-points
+	distributionPointsPayloadLimits = payloadLimits{
+		maxCompressedBytes:   3200000,
+		maxUncompressedBytes: 62914560,
+	}
+)
+
+// payloadEnvelopeBytes is the length of `{"series":[]}` which wraps series in both of payloads.
+const payloadEnvelopeBytes = len(`{"series":[]}`)
+
+// splitSeries packs series into as few payloads as possible.
+// Each payload has at most maxSeries series (no limit when maxSeries <= 0) and fits in limits both of before and after compression.
+func splitSeries[T any](series []T, limits payloadLimits, maxSeries int) ([][]T, error) {
+	var batches [][]T
+	var batch []T
+	size := payloadEnvelopeBytes
+	for _, s := range series {
+		buf, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		// +1 is for the comma separating series.
+		n := len(buf) + 1
+		if payloadEnvelopeBytes+n > limits.maxUncompressedBytes {
+			return nil, fmt.Errorf("series is too large to submit: %d bytes", len(buf))
+		}
+		if len(batch) > 0 && (size+n > limits.maxUncompressedBytes || (maxSeries > 0 && len(batch) >= maxSeries)) {
+			batches = append(batches, batch)
+			batch = nil
+			size = payloadEnvelopeBytes
+		}
+		batch = append(batch, s)
+		size += n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	// Uncompressed size is already checked. Split batches in half until compressed size fits in the limit.
+	var result [][]T
+	for _, b := range batches {
+		r, err := splitByCompressedSize(b, limits)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r...)
+	}
+	return result, nil
+}
+
+func splitByCompressedSize[T any](batch []T, limits payloadLimits) ([][]T, error) {
+	size, err := compressedPayloadSize(batch)
+	if err != nil {
+		return nil, err
+	}
+	if size <= limits.maxCompressedBytes {
+		return [][]T{batch}, nil
+	}
+	if len(batch) == 1 {
+		return nil, fmt.Errorf("series is too large to submit: %d bytes after compression", size)
+	}
+
+	former, err := splitByCompressedSize(batch[:len(batch)/2], limits)
+	if err != nil {
+		return nil, err
+	}
+	latter, err := splitByCompressedSize(batch[len(batch)/2:], limits)
+	if err != nil {
+		return nil, err
+	}
+	return append(former, latter...), nil
+}
+
+// compressedPayloadSize returns the size of payload compressed with deflate which is Content-Encoding used to submit.
+func compressedPayloadSize[T any](batch []T) (int, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(struct {
+		Series []T `json:"series"`
+	}{Series: batch}); err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	return buf.Len(), nil
+}
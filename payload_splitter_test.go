@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type testSeries struct {
+	Metric string `json:"metric"`
+}
+
+func randomString(r *rand.Rand, n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func TestSplitSeries(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	compressible := make([]testSeries, 10)
+	for i := range compressible {
+		compressible[i] = testSeries{Metric: strings.Repeat("a", 100)}
+	}
+	incompressible := make([]testSeries, 10)
+	for i := range incompressible {
+		incompressible[i] = testSeries{Metric: randomString(r, 100)}
+	}
+
+	tests := []struct {
+		name        string
+		series      []testSeries
+		limits      payloadLimits
+		maxSeries   int
+		wantBatches []int
+		wantErr     bool
+	}{
+		{
+			name:        "all series in one payload",
+			series:      compressible,
+			limits:      seriesPayloadLimits,
+			wantBatches: []int{10},
+		},
+		{
+			name:        "limited by max series",
+			series:      compressible,
+			limits:      seriesPayloadLimits,
+			maxSeries:   4,
+			wantBatches: []int{4, 4, 2},
+		},
+		{
+			name:   "limited by uncompressed size",
+			series: compressible,
+			// each series is 113 bytes with comma.
+			limits:      payloadLimits{maxCompressedBytes: 10000, maxUncompressedBytes: 400},
+			wantBatches: []int{3, 3, 3, 1},
+		},
+		{
+			name:        "limited by compressed size",
+			series:      incompressible,
+			limits:      payloadLimits{maxCompressedBytes: 400, maxUncompressedBytes: 10000},
+			wantBatches: []int{2, 3, 2, 3},
+		},
+		{
+			name:    "series larger than limit",
+			series:  compressible,
+			limits:  payloadLimits{maxCompressedBytes: 10000, maxUncompressedBytes: 100},
+			wantErr: true,
+		},
+		{
+			name:        "no series",
+			series:      nil,
+			limits:      seriesPayloadLimits,
+			wantBatches: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitSeries(tt.series, tt.limits, tt.maxSeries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitSeries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var gotBatches []int
+			var total int
+			for _, batch := range got {
+				gotBatches = append(gotBatches, len(batch))
+				total += len(batch)
+
+				buf, err := json.Marshal(struct {
+					Series []testSeries `json:"series"`
+				}{Series: batch})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(buf) > tt.limits.maxUncompressedBytes {
+					t.Errorf("payload is %d bytes, larger than %d", len(buf), tt.limits.maxUncompressedBytes)
+				}
+				size, err := compressedPayloadSize(batch)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size > tt.limits.maxCompressedBytes {
+					t.Errorf("compressed payload is %d bytes, larger than %d", size, tt.limits.maxCompressedBytes)
+				}
+			}
+			if total != len(tt.series) {
+				t.Errorf("splitSeries() returns %d series, want %d", total, len(tt.series))
+			}
+			if len(gotBatches) != len(tt.wantBatches) {
+				t.Fatalf("splitSeries() got batches %v, want %v", gotBatches, tt.wantBatches)
+			}
+			for i := range gotBatches {
+				if gotBatches[i] != tt.wantBatches[i] {
+					t.Fatalf("splitSeries() got batches %v, want %v", gotBatches, tt.wantBatches)
+				}
+			}
+		})
+	}
+}
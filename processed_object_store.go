@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const ProcessedObjectStoreDynamoDB = "dynamodb"
+
+// ErrAlreadyProcessed is returned by ProcessedObjectStore.Claim when the object has been processed or is being processed by others.
+var ErrAlreadyProcessed = errors.New("object is already processed")
+
+// defaultProcessedObjectLease is the max timeout of Lambda, after which the claim of crashed invocation can be taken over.
+const defaultProcessedObjectLease = 15 * time.Minute
+
+// ProcessedObjectStore records log files whose metrics have been submitted,
+// so that redelivered events and retries of Lambda don't double-count requests.
+// An object is claimed before it is read, so that only one of concurrent invocations submits its metrics.
+// The claim is marked as processed after submission, or released on failure so that the object is processed again.
+type ProcessedObjectStore interface {
+	Claim(ctx context.Context, object S3Object) error
+	MarkProcessed(ctx context.Context, object S3Object) error
+	Release(ctx context.Context, object S3Object) error
+}
+
+// NewProcessedObjectStore returns the store configured by `processed_object_store`, or nil when it is not configured.
+// When DRY_RUN environment variable is true, nil is returned as well so that dry runs don't mark objects as processed.
+func NewProcessedObjectStore(config *Config, awsConfig aws.Config) (ProcessedObjectStore, error) {
+	if isDryRun() {
+		return nil, nil
+	}
+	c := config.ProcessedObjectStore
+	switch c.Type {
+	case "":
+		return nil, nil
+	case ProcessedObjectStoreDynamoDB:
+		if c.TableName == "" {
+			return nil, errors.New("processed_object_store.table_name is required for dynamodb")
+		}
+		return NewDynamoDBProcessedObjectStore(dynamodb.NewFromConfig(awsConfig), c.TableName, c.Ttl, c.Lease), nil
+	}
+	return nil, fmt.Errorf("unknown processed_object_store.type: %s", c.Type)
+}
+
+// processedObjectId identifies the object by its ETag as well as its key, so that overwritten object is processed again.
+func processedObjectId(object S3Object) string {
+	return object.Bucket + "/" + object.Key + "@" + strings.Trim(object.ETag, `"`)
+}
+
+// DynamoDBAPI is the subset of DynamoDB API used by DynamoDBProcessedObjectStore. It is implemented by *dynamodb.Client.
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+const (
+	processedObjectStatusPending = "pending"
+	processedObjectStatusDone    = "done"
+
+	// claimCondition allows to claim the object which has never been claimed, or whose claim has expired without being marked.
+	claimCondition = "attribute_not_exists(id) OR (#status = :pending AND lease_expires_at < :now)"
+	// releaseCondition prevents deleting the item marked as processed.
+	releaseCondition = "#status = :pending"
+)
+
+// DynamoDBProcessedObjectStore records processed objects in DynamoDB table whose partition key is `id` of string.
+// Objects are claimed by conditional put of `pending` item, which can be taken over after lease in case the invocation crashed.
+// When ttl is set, items have `expires_at` attribute which can be used as TTL attribute of the table.
+type DynamoDBProcessedObjectStore struct {
+	client    DynamoDBAPI
+	tableName string
+	ttl       time.Duration
+	lease     time.Duration
+	now       func() time.Time
+}
+
+func NewDynamoDBProcessedObjectStore(client DynamoDBAPI, tableName string, ttl time.Duration, lease time.Duration) *DynamoDBProcessedObjectStore {
+	if lease <= 0 {
+		lease = defaultProcessedObjectLease
+	}
+	return &DynamoDBProcessedObjectStore{client: client, tableName: tableName, ttl: ttl, lease: lease, now: time.Now}
+}
+
+func (s *DynamoDBProcessedObjectStore) Claim(ctx context.Context, object S3Object) error {
+	now := s.now()
+	item := s.item(object, processedObjectStatusPending, now)
+	item["lease_expires_at"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(s.lease).Unix(), 10)}
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                &s.tableName,
+		Item:                     item,
+		ConditionExpression:      aws.String(claimCondition),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: processedObjectStatusPending},
+			":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return ErrAlreadyProcessed
+		}
+		return fmt.Errorf("failed to claim processed object in DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoDBProcessedObjectStore) MarkProcessed(ctx context.Context, object S3Object) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: &s.tableName,
+		Item:      s.item(object, processedObjectStatusDone, s.now()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put processed object to DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoDBProcessedObjectStore) Release(ctx context.Context, object S3Object) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 &s.tableName,
+		Key:                       map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: processedObjectId(object)}},
+		ConditionExpression:       aws.String(releaseCondition),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":pending": &types.AttributeValueMemberS{Value: processedObjectStatusPending}},
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete processed object from DynamoDB: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoDBProcessedObjectStore) item(object S3Object, status string, now time.Time) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"id":           &types.AttributeValueMemberS{Value: processedObjectId(object)},
+		"status":       &types.AttributeValueMemberS{Value: status},
+		"processed_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+	}
+	if s.ttl > 0 {
+		item["expires_at"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(s.ttl).Unix(), 10)}
+	}
+	return item
+}
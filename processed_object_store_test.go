@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamoDB is the DynamoDBAPI keeping items in memory, which supports conditions of DynamoDBProcessedObjectStore only.
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	items map[string]map[string]types.AttributeValue
+}
+
+func (d *fakeDynamoDB) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id := params.Item["id"].(*types.AttributeValueMemberS).Value
+	if aws.ToString(params.ConditionExpression) == claimCondition {
+		if item := d.items[id]; item != nil {
+			now := numberValue(params.ExpressionAttributeValues[":now"])
+			if !isPendingItem(item) || numberValue(item["lease_expires_at"]) >= now {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+		}
+	}
+	d.items[id] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (d *fakeDynamoDB) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id := params.Key["id"].(*types.AttributeValueMemberS).Value
+	if aws.ToString(params.ConditionExpression) == releaseCondition && !isPendingItem(d.items[id]) {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	delete(d.items, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func isPendingItem(item map[string]types.AttributeValue) bool {
+	status, ok := item["status"].(*types.AttributeValueMemberS)
+	return ok && status.Value == processedObjectStatusPending
+}
+
+func numberValue(value types.AttributeValue) int64 {
+	n, _ := strconv.ParseInt(value.(*types.AttributeValueMemberN).Value, 10, 64)
+	return n
+}
+
+func TestDynamoDBProcessedObjectStore(t *testing.T) {
+	client := &fakeDynamoDB{items: map[string]map[string]types.AttributeValue{}}
+	store := NewDynamoDBProcessedObjectStore(client, "processed-objects", time.Hour, 0)
+	now := time.Unix(1530570300, 0)
+	store.now = func() time.Time { return now }
+	object := S3Object{Bucket: "my-bucket", Key: exampleLogObjectKey, ETag: `"d41d8cd98f00b204e9800998ecf8427e"`}
+
+	testProcessedObjectStore(t, store, object)
+
+	item := client.items["my-bucket/"+exampleLogObjectKey+"@d41d8cd98f00b204e9800998ecf8427e"]
+	if item == nil {
+		t.Fatalf("item is not put: %v", client.items)
+	}
+	if got := item["status"].(*types.AttributeValueMemberS).Value; got != processedObjectStatusDone {
+		t.Errorf("status = %s, want %s", got, processedObjectStatusDone)
+	}
+	if got := item["expires_at"].(*types.AttributeValueMemberN).Value; got != "1530573900" {
+		t.Errorf("expires_at = %s, want 1530573900", got)
+	}
+
+	// The claim of crashed invocation can be taken over after its lease.
+	other := S3Object{Bucket: "my-bucket", Key: exampleAnotherLogObjectKey, ETag: "d41d8cd98f00b204e9800998ecf8427e"}
+	if err := store.Claim(context.Background(), other); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	now = now.Add(defaultProcessedObjectLease)
+	if err := store.Claim(context.Background(), other); !errors.Is(err, ErrAlreadyProcessed) {
+		t.Errorf("Claim() within lease error = %v, want %v", err, ErrAlreadyProcessed)
+	}
+	now = now.Add(time.Second)
+	if err := store.Claim(context.Background(), other); err != nil {
+		t.Errorf("Claim() after lease error = %v", err)
+	}
+}
+
+// memoryProcessedObjectStore is the ProcessedObjectStore keeping statuses of objects in memory, whose claims have no lease.
+type memoryProcessedObjectStore struct {
+	mu sync.Mutex
+	// statuses is processedObjectStatusPending or processedObjectStatusDone keyed by id of objects.
+	statuses map[string]string
+}
+
+func newMemoryProcessedObjectStore() *memoryProcessedObjectStore {
+	return &memoryProcessedObjectStore{statuses: map[string]string{}}
+}
+
+func (s *memoryProcessedObjectStore) Claim(_ context.Context, object S3Object) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := processedObjectId(object)
+	if _, ok := s.statuses[id]; ok {
+		return ErrAlreadyProcessed
+	}
+	s.statuses[id] = processedObjectStatusPending
+	return nil
+}
+
+func (s *memoryProcessedObjectStore) MarkProcessed(_ context.Context, object S3Object) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[processedObjectId(object)] = processedObjectStatusDone
+	return nil
+}
+
+func (s *memoryProcessedObjectStore) Release(_ context.Context, object S3Object) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := processedObjectId(object)
+	if s.statuses[id] == processedObjectStatusPending {
+		delete(s.statuses, id)
+	}
+	return nil
+}
+
+func TestMemoryProcessedObjectStore(t *testing.T) {
+	object := S3Object{Bucket: "my-bucket", Key: exampleLogObjectKey, ETag: "d41d8cd98f00b204e9800998ecf8427e"}
+	testProcessedObjectStore(t, newMemoryProcessedObjectStore(), object)
+}
+
+func TestNewProcessedObjectStore_dryRun(t *testing.T) {
+	t.Setenv("DRY_RUN", "true")
+	config := &Config{ProcessedObjectStore: ProcessedObjectStoreConfig{Type: ProcessedObjectStoreDynamoDB, TableName: "processed-objects"}}
+	store, err := NewProcessedObjectStore(config, aws.Config{})
+	if err != nil || store != nil {
+		t.Errorf("NewProcessedObjectStore() = %v, %v, want nil", store, err)
+	}
+}
+
+func testProcessedObjectStore(t *testing.T, store ProcessedObjectStore, object S3Object) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := store.Claim(ctx, object); err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if err := store.Claim(ctx, object); !errors.Is(err, ErrAlreadyProcessed) {
+		t.Fatalf("Claim() of claimed object error = %v, want %v", err, ErrAlreadyProcessed)
+	}
+	// Released object can be claimed again.
+	if err := store.Release(ctx, object); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if err := store.Claim(ctx, object); err != nil {
+		t.Fatalf("Claim() of released object error = %v", err)
+	}
+	if err := store.MarkProcessed(ctx, object); err != nil {
+		t.Fatalf("MarkProcessed() error = %v", err)
+	}
+	if err := store.Claim(ctx, object); !errors.Is(err, ErrAlreadyProcessed) {
+		t.Errorf("Claim() of processed object error = %v, want %v", err, ErrAlreadyProcessed)
+	}
+	// Processed object isn't released.
+	if err := store.Release(ctx, object); err != nil {
+		t.Fatalf("Release() of processed object error = %v", err)
+	}
+	if err := store.Claim(ctx, object); !errors.Is(err, ErrAlreadyProcessed) {
+		t.Errorf("Claim() of processed object after Release() error = %v, want %v", err, ErrAlreadyProcessed)
+	}
+
+	other := object
+	other.ETag = "9e107d9d372bb6826bd81d3542a419d6"
+	if err := store.Claim(ctx, other); err != nil {
+		t.Errorf("Claim() of other ETag error = %v", err)
+	}
+}
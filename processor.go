@@ -1,51 +1,151 @@
 package main
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 )
 
 type Processor struct {
-	LogFileReader    *LogFileReader
-	MetricsSubmitter *MetricsSubmitter
+	LogFileReader *LogFileReader
+	SeriesBuilder *SeriesBuilder
+	Sink          Sink
 }
 
-func NewProcessor() (*Processor, error) {
+func NewProcessor(config *Config) (*Processor, error) {
+	if err := config.MalformedLines.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.SubmitRetry.Validate(); err != nil {
+		return nil, err
+	}
 	var processor Processor
-	config, err := NewConfigFromFile(os.Getenv("CONFIG_PATH"))
+	var err error
+	processor.LogFileReader = NewLogFileReader(config)
+	processor.SeriesBuilder = NewSeriesBuilder(config)
+	processor.Sink, err = NewSink(config)
 	if err != nil {
 		return nil, err
 	}
-	processor.LogFileReader = NewLogFileReader(config.PathTransformingRules, config.TargetPaths)
-	processor.MetricsSubmitter = NewMetricsSubmitter(config.RequestCountMetricName, config.TargetProcessingTimeMetricName, config.CustomTags)
 	return &processor, nil
 }
 
 func (p *Processor) ProcessLogfile(r io.Reader, s3ObjectKey string) error {
-	zr, err := gzip.NewReader(r)
+	logMetrics, err := p.ReadLogfile(r, s3ObjectKey)
 	if err != nil {
 		return err
 	}
-	defer zr.Close()
+	return p.Submit(logMetrics)
+}
+
+// ReadLogfile reads log file and returns metrics keyed including IP address of load balancer node,
+// so that metrics of multiple log files can be merged by LogMetrics.Merge.
+// The log file is read as ALB, NLB, CLB or ALB connection log file detected by detectLogType.
+// Log files are gzipped except CLB's, so the log file is decompressed only when it is gzipped.
+func (p *Processor) ReadLogfile(r io.Reader, s3ObjectKey string) (*LogMetrics, error) {
+	br := bufio.NewReader(r)
+	if isGzipped(br) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
 
-	fmt.Println("start reading log file")
+	logType := detectLogType(s3ObjectKey, br)
+	fmt.Fprintf(os.Stderr, "start reading %s log file\n", logType)
 
-	metricsMap, err := p.LogFileReader.Read(zr)
+	var result *ReadResult
+	var err error
+	switch logType {
+	case LogTypeNlb:
+		result, err = p.LogFileReader.ReadNlb(br)
+	case LogTypeClb:
+		result, err = p.LogFileReader.ReadClb(br)
+	case LogTypeAlbConnection:
+		result, err = p.LogFileReader.ReadAlbConnection(br)
+	default:
+		result, err = p.LogFileReader.Read(br)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fmt.Println("finish reading log file")
+	fmt.Fprintln(os.Stderr, "finish reading log file")
+
+	logMetrics := NewLogMetrics()
+	ipAddress := loadBalancerIpAddress(s3ObjectKey)
+	for key, metric := range result.Metrics {
+		metric.IpAddress = ipAddress
+		logMetrics.Metrics[key+"_"+ipAddress] = metric
+	}
+	// The name of NLB log file has no IP address, and NLB metrics aren't tagged by it.
+	for key, metric := range result.NlbMetrics {
+		logMetrics.NlbMetrics[key] = metric
+	}
+	elb := loadBalancerElb(s3ObjectKey)
+	for key, metric := range result.AlbConnectionMetrics {
+		metric.Elb = elb
+		metric.IpAddress = ipAddress
+		logMetrics.AlbConnectionMetrics[key+"_"+elb+"_"+ipAddress] = metric
+	}
+	if result.MalformedLines > 0 {
+		// Malformed lines have no timestamp, so the end of interval of the log file is used.
+		timestamp, ok := logFileTimestamp(s3ObjectKey)
+		if !ok {
+			timestamp = time.Now().Truncate(time.Minute)
+		}
+		logMetrics.MalformedLines[logType.String()+"_"+elb] = &MalformedLinesMetric{
+			CountMap: map[Timestamp]int{Timestamp(timestamp.Unix()): result.MalformedLines},
+			LogType:  logType,
+			Elb:      elb,
+		}
+	}
+	return logMetrics, nil
+}
 
-	fmt.Println("start submitting metrics")
+func (p *Processor) Submit(logMetrics *LogMetrics) error {
+	fmt.Fprintln(os.Stderr, "start submitting metrics")
 
-	err = p.MetricsSubmitter.Submit(metricsMap, s3ObjectKey)
+	series := p.SeriesBuilder.Build(logMetrics.Metrics)
+	series = append(series, p.SeriesBuilder.BuildNlb(logMetrics.NlbMetrics)...)
+	series = append(series, p.SeriesBuilder.BuildAlbConnection(logMetrics.AlbConnectionMetrics)...)
+	series = append(series, p.SeriesBuilder.BuildMalformedLines(logMetrics.MalformedLines)...)
+	err := p.Sink.Submit(series)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("finish submitting metrics")
+	fmt.Fprintln(os.Stderr, "finish submitting metrics")
 	return nil
 }
+
+// isGzipped returns whether the reader starts with the magic number of gzip, without consuming it.
+func isGzipped(r *bufio.Reader) bool {
+	b, _ := r.Peek(2)
+	return len(b) == 2 && b[0] == 0x1f && b[1] == 0x8b
+}
+
+// loadBalancerIpAddress returns the IP address in the name of log file, or empty string when the name doesn't have it (e.g. stdin).
+func loadBalancerIpAddress(s3ObjectKey string) string {
+	fields := logFileNameFields(s3ObjectKey)
+	if len(fields) < 6 {
+		return ""
+	}
+	return fields[5]
+}
+
+// loadBalancerElb returns the load balancer in the name of log file in the same format as `elb` field of ALB log record,
+// e.g. `app/my-loadbalancer/50dc6c495c0c9188` for `app.my-loadbalancer.50dc6c495c0c9188`, or empty string when the name doesn't have it.
+func loadBalancerElb(s3ObjectKey string) string {
+	fields := logFileNameFields(s3ObjectKey)
+	if len(fields) < 4 || fields[1] != "elasticloadbalancing" {
+		return ""
+	}
+	return strings.ReplaceAll(fields[3], ".", "/")
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	exampleLogObjectKey              = "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/07/02/123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20180702T2225Z_172.160.001.192_20sg8hgm.log.gz"
+	exampleAnotherLogObjectKey       = "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/07/02/123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20180702T2225Z_172.160.001.193_4kd8s0x3.log.gz"
+	exampleNlbLogObjectKey           = "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2018/12/20/123456789012_elasticloadbalancing_us-east-2_net.my-network-loadbalancer.c6e77e28c25b2234_20181220T0300Z_8a2f0b8c.log.gz"
+	exampleClbLogObjectKey           = "AWSLogs/123456789012/elasticloadbalancing/us-west-2/2015/05/13/123456789012_elasticloadbalancing_us-west-2_my-loadbalancer_20150513T2340Z_172.160.001.192_20sg8hgm.log"
+	exampleAlbConnectionLogObjectKey = "AWSLogs/123456789012/elasticloadbalancing/us-east-2/2023/10/04/conn_log.123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.50dc6c495c0c9188_20231004T1730Z_172.160.001.192_20sg8hgm.log.gz"
+)
+
+// newTestProcessor returns the processor of config submitting series to the returned sink.
+func newTestProcessor(config *Config) (*Processor, *recordingSink) {
+	sink := &recordingSink{}
+	return &Processor{
+		LogFileReader: NewLogFileReader(config),
+		SeriesBuilder: NewSeriesBuilder(config),
+		Sink:          sink,
+	}, sink
+}
+
+func gzipBytes(t *testing.T, s string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestProcessor_ProcessLogfile(t *testing.T) {
+	config := &Config{
+		RequestCountMetricName:         "request_count",
+		TargetProcessingTimeMetricName: "target_processing_time",
+		TargetPaths:                    []string{"/"},
+	}
+	p, sink := newTestProcessor(config)
+
+	err := p.ProcessLogfile(gzipBytes(t, exampleHttpEntry+"\n"+exampleHttpsEntry+"\n"), exampleLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	tags := []string{
+		"elb:app/my-loadbalancer/50dc6c495c0c9188",
+		"target_group_arn:arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067",
+		"path:/",
+		"method:GET",
+		"elb_status_code:200",
+		"target_status_code:200",
+		"ip_address:172.160.001.192",
+	}
+	if len(sink.series) != 2 {
+		t.Fatalf("ProcessLogfile() submits %d series, want 2", len(sink.series))
+	}
+	count := sink.series[0]
+	if count.Name != "request_count" || count.Type != SeriesTypeCount {
+		t.Errorf("unexpected series %v", count)
+	}
+	if !reflect.DeepEqual(count.TagStrings(), tags) {
+		t.Errorf("unexpected tags %v, want %v", count.TagStrings(), tags)
+	}
+	if !reflect.DeepEqual(count.Points, []SeriesPoint{{Timestamp: 1530570180, Value: 2}}) {
+		t.Errorf("unexpected points %v", count.Points)
+	}
+	distribution := sink.series[1]
+	if distribution.Name != "target_processing_time" || distribution.Type != SeriesTypeDistribution {
+		t.Errorf("unexpected series %v", distribution)
+	}
+	if !reflect.DeepEqual(distribution.Points, []SeriesPoint{{Timestamp: 1530570180, Values: []float64{0.001, 0.048}}}) {
+		t.Errorf("unexpected points %v", distribution.Points)
+	}
+}
+
+func TestProcessor_ProcessLogfile_processingTimes(t *testing.T) {
+	config := &Config{
+		TargetProcessingTimeMetricName:   "target_processing_time",
+		RequestProcessingTimeMetricName:  "request_processing_time",
+		ResponseProcessingTimeMetricName: "response_processing_time",
+		TotalLatencyMetricName:           "total_latency",
+		TargetPaths:                      []string{"/"},
+	}
+	p, sink := newTestProcessor(config)
+
+	err := p.ProcessLogfile(gzipBytes(t, exampleHttpsEntry+"\n"+exampleLoadBalancerCouldNotDispatch+"\n"), exampleLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	// All of processing times of the request not dispatched to target are -1, so none of its processing times are submitted.
+	var names []string
+	for _, series := range sink.series {
+		names = append(names, series.Name)
+	}
+	wantNames := []string{"target_processing_time", "request_processing_time", "response_processing_time", "total_latency"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("ProcessLogfile() submits %v, want %v", names, wantNames)
+	}
+	total := sink.series[3]
+	if total.Type != SeriesTypeDistribution || total.Unit != "second" || total.TagValue("target_status_code_group") != "2xx" {
+		t.Errorf("unexpected series %+v", total)
+	}
+	if !reflect.DeepEqual(total.Points, []SeriesPoint{{Timestamp: 1530570180, Values: []float64{0.086 + 0.048 + 0.037}}}) {
+		t.Errorf("unexpected points %v", total.Points)
+	}
+}
+
+func TestProcessor_ProcessLogfile_bytes(t *testing.T) {
+	config := &Config{
+		ReceivedBytesMetricName: "received_bytes",
+		SentBytesMetricName:     "sent_bytes",
+		RequestSizeMetricName:   "request_size",
+		ResponseSizeMetricName:  "response_size",
+		TargetPaths:             []string{"/"},
+	}
+	p, sink := newTestProcessor(config)
+
+	err := p.ProcessLogfile(gzipBytes(t, exampleLoadBalancerCouldNotDispatch+"\n"+exampleLoadBalancerCouldNotDispatch+"\n"), exampleLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	timestamp := Timestamp(1655079960)
+	tests := []struct {
+		name       string
+		seriesType SeriesType
+		points     []SeriesPoint
+	}{
+		{name: "received_bytes", seriesType: SeriesTypeCount, points: []SeriesPoint{{Timestamp: timestamp, Value: 470}}},
+		{name: "sent_bytes", seriesType: SeriesTypeCount, points: []SeriesPoint{{Timestamp: timestamp, Value: 1544}}},
+		{name: "request_size", seriesType: SeriesTypeDistribution, points: []SeriesPoint{{Timestamp: timestamp, Values: []float64{235, 235}}}},
+		{name: "response_size", seriesType: SeriesTypeDistribution, points: []SeriesPoint{{Timestamp: timestamp, Values: []float64{772, 772}}}},
+	}
+	if len(sink.series) != len(tests) {
+		t.Fatalf("ProcessLogfile() submits %d series, want %d", len(sink.series), len(tests))
+	}
+	for i, tt := range tests {
+		series := sink.series[i]
+		if series.Name != tt.name || series.Type != tt.seriesType || series.Unit != "byte" || series.TagValue("elb_status_code") != "400" || series.TagValue("path") != "/" {
+			t.Errorf("unexpected series %+v", series)
+		}
+		if !reflect.DeepEqual(series.Points, tt.points) {
+			t.Errorf("%s points = %v, want %v", tt.name, series.Points, tt.points)
+		}
+	}
+}
+
+func TestProcessor_ProcessLogfile_noTargetResponse(t *testing.T) {
+	config := &Config{
+		TargetProcessingTimeMetricName:  "target_processing_time",
+		NoTargetResponseCountMetricName: "no_target_response_count",
+		TargetPaths:                     []string{"/"},
+	}
+	p, sink := newTestProcessor(config)
+
+	timedOut := strings.Replace(exampleHttpsEntry, "0.086 0.048 0.037 200 200", "0.001 -1 -1 504 -", 1)
+	timedOut = strings.Replace(timedOut, `"-" "-" "10.0.0.1:80" "200"`, `"-" "TargetResponseTimeout" "10.0.0.1:80" "-"`, 1)
+	err := p.ProcessLogfile(gzipBytes(t, exampleHttpsEntry+"\n"+timedOut+"\n"+timedOut+"\n"), exampleLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	// The request timed out is counted instead of the distribution of target processing time.
+	if len(sink.series) != 2 {
+		t.Fatalf("ProcessLogfile() submits %d series, want 2", len(sink.series))
+	}
+	distribution := sink.series[0]
+	if distribution.Name != "target_processing_time" || !reflect.DeepEqual(distribution.Points, []SeriesPoint{{Timestamp: 1530570180, Values: []float64{0.048}}}) {
+		t.Errorf("unexpected series %+v", distribution)
+	}
+	count := sink.series[1]
+	if count.Name != "no_target_response_count" || count.Type != SeriesTypeCount || count.Unit != "request" ||
+		count.TagValue("error_reason") != "TargetResponseTimeout" || count.TagValue("elb_status_code") != "504" {
+		t.Errorf("unexpected series %+v", count)
+	}
+	if !reflect.DeepEqual(count.Points, []SeriesPoint{{Timestamp: 1530570180, Value: 2}}) {
+		t.Errorf("unexpected points %v", count.Points)
+	}
+}
+
+func TestProcessor_ProcessLogfile_malformedLines(t *testing.T) {
+	config := &Config{
+		TargetProcessingTimeMetricName: "target_processing_time",
+		TargetPaths:                    []string{"/"},
+		CustomTags:                     []Tag{{Name: "env", EnvKey: "TEST_ENV"}},
+		MalformedLines:                 MalformedLinesConfig{Policy: "skip", MetricsName: "malformed_lines"},
+	}
+	t.Setenv("TEST_ENV", "test")
+	p, err := NewProcessor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordingSink{}
+	p.Sink = sink
+
+	err = p.ProcessLogfile(gzipBytes(t, exampleHttpEntry+"\ngarbage\n\n"), exampleLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	if len(sink.series) != 2 {
+		t.Fatalf("ProcessLogfile() submits %d series, want 2", len(sink.series))
+	}
+	want := Series{
+		Name:   "malformed_lines",
+		Type:   SeriesTypeCount,
+		Unit:   "line",
+		Tags:   []SeriesTag{{Name: "elb", Value: "app/my-loadbalancer/50dc6c495c0c9188"}, {Name: "log_type", Value: "alb"}, {Name: "env", Value: "test"}},
+		Points: []SeriesPoint{{Timestamp: 1530570300, Value: 2}},
+	}
+	if !reflect.DeepEqual(sink.series[1], want) {
+		t.Errorf("ProcessLogfile() submits %+v, want %+v", sink.series[1], want)
+	}
+}
+
+func TestProcessor_ProcessLogfile_nlb(t *testing.T) {
+	config := &Config{
+		TargetProcessingTimeMetricName: "target_processing_time",
+		Nlb: NlbConfig{
+			ConnectionCountMetricName:  "connection_count",
+			TlsHandshakeTimeMetricName: "tls_handshake_time",
+			SentBytesMetricName:        "sent_bytes",
+		},
+	}
+	p, sink := newTestProcessor(config)
+
+	err := p.ProcessLogfile(gzipBytes(t, exampleNlbEntry+"\n"+exampleNlbEntry+"\n"), exampleNlbLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	tags := []SeriesTag{
+		{Name: "elb", Value: "net/my-network-loadbalancer/c6e77e28c25b2234"},
+		{Name: "listener", Value: "g3d4b5e8bb8464cd"},
+		{Name: "tls_protocol_version", Value: "tlsv12"},
+		{Name: "tls_cipher", Value: "ECDHE-RSA-AES128-SHA"},
+	}
+	want := []Series{
+		{Name: "connection_count", Type: SeriesTypeCount, Unit: "connection", Tags: tags, Points: []SeriesPoint{{Timestamp: 1545274780, Value: 2}}},
+		{Name: "tls_handshake_time", Type: SeriesTypeDistribution, Unit: "second", Tags: tags, Points: []SeriesPoint{{Timestamp: 1545274780, Values: []float64{0.002, 0.002}}}},
+		{Name: "sent_bytes", Type: SeriesTypeCount, Unit: "byte", Tags: tags, Points: []SeriesPoint{{Timestamp: 1545274780, Value: 492}}},
+	}
+	if !reflect.DeepEqual(sink.series, want) {
+		t.Errorf("ProcessLogfile() submits %+v, want %+v", sink.series, want)
+	}
+}
+
+func TestProcessor_ProcessLogfile_clb(t *testing.T) {
+	config := &Config{
+		RequestCountMetricName:         "request_count",
+		TargetProcessingTimeMetricName: "target_processing_time",
+		TargetPaths:                    []string{"/"},
+	}
+	p, sink := newTestProcessor(config)
+
+	// CLB's log file isn't gzipped.
+	err := p.ProcessLogfile(strings.NewReader(exampleClbHttpEntry+"\n"+exampleClbTcpEntry+"\n"), exampleClbLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	if len(sink.series) != 2 {
+		t.Fatalf("ProcessLogfile() submits %d series, want 2", len(sink.series))
+	}
+	wantTags := []string{
+		"elb:my-loadbalancer",
+		"path:/",
+		"method:GET",
+		"elb_status_code:200",
+		"backend_status_code:200",
+		"backend_status_code_group:2xx",
+		"ip_address:172.160.001.192",
+	}
+	distribution := sink.series[1]
+	if !reflect.DeepEqual(distribution.TagStrings(), wantTags) {
+		t.Errorf("unexpected tags %v, want %v", distribution.TagStrings(), wantTags)
+	}
+	if !reflect.DeepEqual(distribution.Points, []SeriesPoint{{Timestamp: 1431560383, Values: []float64{0.001048}}}) {
+		t.Errorf("unexpected points %v", distribution.Points)
+	}
+}
+
+func TestProcessor_ProcessLogfile_albConnection(t *testing.T) {
+	config := &Config{
+		AlbConnection: AlbConnectionConfig{
+			ConnectionCountMetricName:     "connection_count",
+			TlsHandshakeLatencyMetricName: "tls_handshake_latency",
+		},
+	}
+	p, sink := newTestProcessor(config)
+
+	err := p.ProcessLogfile(gzipBytes(t, exampleAlbConnectionEntry+"\n"+exampleAlbConnectionFailedEntry+"\n"), exampleAlbConnectionLogObjectKey)
+	if err != nil {
+		t.Fatalf("ProcessLogfile() error = %v", err)
+	}
+
+	tags := func(protocol, cipher, status string) []SeriesTag {
+		return []SeriesTag{
+			{Name: "elb", Value: "app/my-loadbalancer/50dc6c495c0c9188"},
+			{Name: "listener_port", Value: "443"},
+			{Name: "tls_protocol", Value: protocol},
+			{Name: "tls_cipher", Value: cipher},
+			{Name: "tls_verify_status", Value: status},
+			{Name: "ip_address", Value: "172.160.001.192"},
+		}
+	}
+	succeeded := tags("TLSv1.2", "ECDHE-RSA-AES128-GCM-SHA256", "Success")
+	want := []Series{
+		// The failed handshake has no latency.
+		{Name: "connection_count", Type: SeriesTypeCount, Unit: "connection", Tags: tags("-", "-", "Failed:UnableToGetIssuerCert"), Points: []SeriesPoint{{Timestamp: 1696440582, Value: 1}}},
+		{Name: "connection_count", Type: SeriesTypeCount, Unit: "connection", Tags: succeeded, Points: []SeriesPoint{{Timestamp: 1696440582, Value: 1}}},
+		{Name: "tls_handshake_latency", Type: SeriesTypeDistribution, Unit: "second", Tags: succeeded, Points: []SeriesPoint{{Timestamp: 1696440582, Values: []float64{0.012}}}},
+	}
+	if !reflect.DeepEqual(sink.series, want) {
+		t.Errorf("ProcessLogfile() submits %+v, want %+v", sink.series, want)
+	}
+}
+
+func Test_loadBalancerElb(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: exampleAlbConnectionLogObjectKey, want: "app/my-loadbalancer/50dc6c495c0c9188"},
+		{key: "123456789012_elasticloadbalancing_us-west-2_my-loadbalancer_20140215T2340Z_172.160.001.192_20sg8hgm.log", want: "my-loadbalancer"},
+		{key: "-", want: ""},
+	}
+	for _, tt := range tests {
+		if got := loadBalancerElb(tt.key); got != tt.want {
+			t.Errorf("loadBalancerElb(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestNewProcessor_invalidMalformedLinesPolicy(t *testing.T) {
+	if _, err := NewProcessor(&Config{MalformedLines: MalformedLinesConfig{Policy: "ignore"}}); err == nil {
+		t.Error("NewProcessor() error = nil")
+	}
+}
+
+func Test_loadBalancerIpAddress(t *testing.T) {
+	type args struct {
+		s string
+	}
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "with prefix",
+			args: args{
+				s: "s3://my-bucket/prefix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2016/05/01/123456789012_elasticloadbalancing_us-east-2_net.app.my-loadbalancer.1234567890abcdef_20140215T2340Z_172.160.001.192_20sg8hgm.log.gz",
+			},
+			want: "172.160.001.192",
+		},
+		{
+			name: "with prefix includes underscore",
+			args: args{
+				s: "s3://my-bucket/pre_fix/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2016/05/01/123456789012_elasticloadbalancing_us-east-2_net.app.my-loadbalancer.1234567890abcdef_20140215T2340Z_172.160.001.192_20sg8hgm.log.gz",
+			},
+			want: "172.160.001.192",
+		},
+		{
+			name: "connection log file",
+			args: args{
+				s: "s3://my-bucket/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2016/05/01/conn_log.123456789012_elasticloadbalancing_us-east-2_app.my-loadbalancer.1234567890abcdef_20140215T2340Z_172.160.001.192_20sg8hgm.log.gz",
+			},
+			want: "172.160.001.192",
+		},
+		{
+			name: "without prefix",
+			args: args{
+				s: "s3://my-bucket/AWSLogs/123456789012/elasticloadbalancing/us-east-2/2016/05/01/123456789012_elasticloadbalancing_us-east-2_net.app.my-loadbalancer.1234567890abcdef_20140215T2340Z_172.160.001.192_20sg8hgm.log.gz",
+			},
+			want: "172.160.001.192",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadBalancerIpAddress(tt.args.s); got != tt.want {
+				t.Errorf("loadBalancerIpAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
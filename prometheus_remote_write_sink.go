@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// defaultPrometheusMaxSeriesPerRequest is used when prometheus_remote_write.max_series_per_request is not configured.
+	defaultPrometheusMaxSeriesPerRequest = 500
+	// defaultPrometheusTimeout is used when prometheus_remote_write.timeout is not configured.
+	defaultPrometheusTimeout = 30 * time.Second
+)
+
+// defaultPrometheusBuckets is same as DefBuckets of Prometheus client library.
+var defaultPrometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusRemoteWriteSink is the Sink sending series to Prometheus compatible backend (e.g. Mimir) via remote write protocol.
+// see: https://prometheus.io/docs/specs/prw/remote_write_spec/
+//
+// Count series are sent as samples of the count in each timestamp, not as cumulative counter.
+// Distribution series are sent as classic histogram, that is `_bucket`, `_sum` and `_count` series, of values in each timestamp.
+type PrometheusRemoteWriteSink struct {
+	endpoint            string
+	basicAuth           *BasicAuthConfig
+	bearerTokenEnvKey   string
+	headers             map[string]string
+	buckets             []float64
+	maxSeriesPerRequest int
+	submitConcurrency   int
+	retrier             *Retrier
+	httpClient          *http.Client
+}
+
+func NewPrometheusRemoteWriteSink(config *Config) (*PrometheusRemoteWriteSink, error) {
+	c := config.PrometheusRemoteWrite
+	if c.Endpoint == "" {
+		return nil, fmt.Errorf("prometheus_remote_write.endpoint is required")
+	}
+	if err := validatePromCustomTags(config.CustomTags); err != nil {
+		return nil, err
+	}
+	buckets := c.Buckets
+	if len(buckets) == 0 {
+		buckets = defaultPrometheusBuckets
+	}
+	buckets = slices.Sorted(slices.Values(buckets))
+	maxSeriesPerRequest := c.MaxSeriesPerRequest
+	if maxSeriesPerRequest == 0 {
+		maxSeriesPerRequest = defaultPrometheusMaxSeriesPerRequest
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultPrometheusTimeout
+	}
+	submitConcurrency := config.SubmitConcurrency
+	if submitConcurrency == 0 {
+		submitConcurrency = defaultSubmitConcurrency
+	}
+	return &PrometheusRemoteWriteSink{
+		endpoint:            c.Endpoint,
+		basicAuth:           c.BasicAuth,
+		bearerTokenEnvKey:   c.BearerTokenEnvKey,
+		headers:             c.Headers,
+		buckets:             buckets,
+		maxSeriesPerRequest: maxSeriesPerRequest,
+		submitConcurrency:   submitConcurrency,
+		retrier:             NewRetrier(config.SubmitRetry),
+		httpClient:          &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (s *PrometheusRemoteWriteSink) Submit(series []Series) error {
+	var timeSeries []promTimeSeries
+	for _, se := range series {
+		switch se.Type {
+		case SeriesTypeCount:
+			timeSeries = append(timeSeries, s.countTimeSeries(se))
+		case SeriesTypeDistribution:
+			timeSeries = append(timeSeries, s.histogramTimeSeries(se)...)
+		}
+	}
+
+	var eg errgroup.Group
+	eg.SetLimit(s.submitConcurrency)
+	for batch := range slices.Chunk(timeSeries, s.maxSeriesPerRequest) {
+		eg.Go(func() error {
+			body := snappy.Encode(nil, marshalWriteRequest(batch))
+			return s.retrier.Do(context.Background(), "prometheus remote write", func() (*http.Response, error) {
+				return s.post(body)
+			})
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return fmt.Errorf("prometheus remote write fails: %w", err)
+	}
+	return nil
+}
+
+func (s *PrometheusRemoteWriteSink) post(body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "send-alb-metrics-to-datadog")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	if s.basicAuth != nil {
+		req.SetBasicAuth(s.basicAuth.Username, os.Getenv(s.basicAuth.PasswordEnvKey))
+	}
+	if s.bearerTokenEnvKey != "" {
+		req.Header.Set("Authorization", "Bearer "+os.Getenv(s.bearerTokenEnvKey))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		buf, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(buf)))
+	}
+	return resp, nil
+}
+
+func (s *PrometheusRemoteWriteSink) countTimeSeries(se Series) promTimeSeries {
+	ts := promTimeSeries{labels: promLabels(promMetricName(se.Name), se.Tags)}
+	for _, point := range se.Points {
+		ts.samples = append(ts.samples, promSample{value: point.Value, timestamp: point.Timestamp})
+	}
+	return ts
+}
+
+func (s *PrometheusRemoteWriteSink) histogramTimeSeries(se Series) []promTimeSeries {
+	name := promMetricName(se.Name)
+	buckets := make([]promTimeSeries, len(s.buckets)+1)
+	for i, le := range s.buckets {
+		buckets[i].labels = promLabels(name+"_bucket", append(slices.Clone(se.Tags), SeriesTag{Name: "le", Value: strconv.FormatFloat(le, 'g', -1, 64)}))
+	}
+	buckets[len(s.buckets)].labels = promLabels(name+"_bucket", append(slices.Clone(se.Tags), SeriesTag{Name: "le", Value: "+Inf"}))
+	sum := promTimeSeries{labels: promLabels(name+"_sum", se.Tags)}
+	count := promTimeSeries{labels: promLabels(name+"_count", se.Tags)}
+
+	for _, point := range se.Points {
+		counts := make([]float64, len(s.buckets)+1)
+		var total float64
+		for _, v := range point.Values {
+			total += v
+			i, _ := slices.BinarySearch(s.buckets, v)
+			counts[i]++
+		}
+		// Buckets of Prometheus histogram are cumulative.
+		var cumulative float64
+		for i := range counts {
+			cumulative += counts[i]
+			buckets[i].samples = append(buckets[i].samples, promSample{value: cumulative, timestamp: point.Timestamp})
+		}
+		sum.samples = append(sum.samples, promSample{value: total, timestamp: point.Timestamp})
+		count.samples = append(count.samples, promSample{value: float64(len(point.Values)), timestamp: point.Timestamp})
+	}
+	return append(buckets, sum, count)
+}
+
+type promLabel struct {
+	name  string
+	value string
+}
+
+type promSample struct {
+	value     float64
+	timestamp Timestamp
+}
+
+type promTimeSeries struct {
+	labels  []promLabel
+	samples []promSample
+}
+
+// promLabels returns labels sorted by name as required by remote write protocol.
+func promLabels(name string, tags []SeriesTag) []promLabel {
+	labels := []promLabel{{name: "__name__", value: name}}
+	for _, tag := range tags {
+		labels = append(labels, promLabel{name: promLabelName(tag.Name), value: tag.Value})
+	}
+	slices.SortStableFunc(labels, func(a, b promLabel) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return labels
+}
+
+// validatePromCustomTags rejects custom tags whose label names are reserved by Prometheus or the same as other tags,
+// because the backend rejects the whole write request with such labels.
+func validatePromCustomTags(tags []Tag) error {
+	names := map[string]bool{}
+	for _, name := range seriesTagNames {
+		names[promLabelName(name)] = true
+	}
+	for _, tag := range tags {
+		name := promLabelName(tag.Name)
+		if name == "" || name == "le" || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("custom_tags: %q is reserved label name of Prometheus", tag.Name)
+		}
+		if names[name] {
+			return fmt.Errorf("custom_tags: label name of %q is duplicated with other tags: %s", tag.Name, name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// promMetricName replaces characters not allowed in metric name. e.g. `foo.alb.request_count` is `foo_alb_request_count`.
+func promMetricName(s string) string {
+	return sanitizePromName(s, true)
+}
+
+func promLabelName(s string) string {
+	return sanitizePromName(s, false)
+}
+
+func sanitizePromName(s string, allowColon bool) string {
+	b := []byte(s)
+	for i, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') || (allowColon && c == ':')
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// marshalWriteRequest encodes prometheus.WriteRequest message of remote write protocol 1.0.
+// see: https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto
+func marshalWriteRequest(timeSeries []promTimeSeries) []byte {
+	var b []byte
+	for _, ts := range timeSeries {
+		var tsb []byte
+		for _, label := range ts.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, label.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, label.value)
+			tsb = protowire.AppendTag(tsb, 1, protowire.BytesType)
+			tsb = protowire.AppendBytes(tsb, lb)
+		}
+		for _, sample := range ts.samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(sample.value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			// Timestamp of remote write protocol is milliseconds.
+			sb = protowire.AppendVarint(sb, uint64(int64(sample.timestamp)*1000))
+			tsb = protowire.AppendTag(tsb, 2, protowire.BytesType)
+			tsb = protowire.AppendBytes(tsb, sb)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, tsb)
+	}
+	return b
+}
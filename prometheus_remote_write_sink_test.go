@@ -0,0 +1,224 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// unmarshalWriteRequest decodes prometheus.WriteRequest message into the map of series name with labels to samples.
+func unmarshalWriteRequest(t *testing.T, b []byte) map[string][]promSample {
+	t.Helper()
+	result := map[string][]promSample{}
+	eachField(t, b, func(num protowire.Number, v []byte) {
+		var labels []string
+		var samples []promSample
+		eachField(t, v, func(num protowire.Number, v []byte) {
+			switch num {
+			case 1:
+				var name, value string
+				eachField(t, v, func(num protowire.Number, v []byte) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				labels = append(labels, name+"="+value)
+			case 2:
+				var sample promSample
+				eachField(t, v, func(num protowire.Number, v []byte) {
+					if num == 1 {
+						bits, _ := protowire.ConsumeFixed64(v)
+						sample.value = math.Float64frombits(bits)
+					} else {
+						ms, _ := protowire.ConsumeVarint(v)
+						sample.timestamp = Timestamp(int64(ms) / 1000)
+					}
+				})
+				samples = append(samples, sample)
+			}
+		})
+		result[strings.Join(labels, ",")] = samples
+	})
+	return result
+}
+
+// eachField calls f with the field number and value of each field.
+// Value of bytes type is its content, and value of other types is its encoded bytes.
+func eachField(t *testing.T, b []byte, f func(protowire.Number, []byte)) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		m := protowire.ConsumeFieldValue(num, typ, b)
+		if m < 0 {
+			t.Fatalf("invalid field: %v", protowire.ParseError(m))
+		}
+		v := b[:m]
+		if typ == protowire.BytesType {
+			v, _ = protowire.ConsumeBytes(v)
+		}
+		f(num, v)
+		b = b[m:]
+	}
+}
+
+func TestPrometheusRemoteWriteSink_Submit(t *testing.T) {
+	t.Setenv("TEST_PROMETHEUS_PASSWORD", "secret")
+
+	var mu sync.Mutex
+	got := map[string][]promSample{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if r.Header.Get("X-Scope-OrgID") != "tenant" {
+			t.Errorf("unexpected X-Scope-OrgID: %s", r.Header.Get("X-Scope-OrgID"))
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			t.Errorf("unexpected basic auth: %s, %s", user, password)
+		}
+		compressed, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		for k, v := range unmarshalWriteRequest(t, body) {
+			got[k] = v
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewPrometheusRemoteWriteSink(&Config{
+		PrometheusRemoteWrite: PrometheusRemoteWriteConfig{
+			Endpoint:            server.URL,
+			BasicAuth:           &BasicAuthConfig{Username: "user", PasswordEnvKey: "TEST_PROMETHEUS_PASSWORD"},
+			Headers:             map[string]string{"X-Scope-OrgID": "tenant"},
+			Buckets:             []float64{0.1, 1},
+			MaxSeriesPerRequest: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags := []SeriesTag{{Name: "elb", Value: "app/my-loadbalancer/50dc6c495c0c9188"}, {Name: "path", Value: "/"}}
+	err = sink.Submit([]Series{
+		{
+			Name:   "foo.alb.request_count",
+			Type:   SeriesTypeCount,
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1, Value: 3}, {Timestamp: 2, Value: 1}},
+		},
+		{
+			Name:   "foo.alb.target_processing_time",
+			Type:   SeriesTypeDistribution,
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1, Values: []float64{0.05, 0.1, 0.5}}, {Timestamp: 2, Values: []float64{3}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	const elb = "elb=app/my-loadbalancer/50dc6c495c0c9188"
+	const labels = elb + ",path=/"
+	want := map[string][]promSample{
+		"__name__=foo_alb_request_count," + labels:                                  {{value: 3, timestamp: 1}, {value: 1, timestamp: 2}},
+		"__name__=foo_alb_target_processing_time_bucket," + elb + ",le=0.1,path=/":  {{value: 2, timestamp: 1}, {value: 0, timestamp: 2}},
+		"__name__=foo_alb_target_processing_time_bucket," + elb + ",le=1,path=/":    {{value: 3, timestamp: 1}, {value: 0, timestamp: 2}},
+		"__name__=foo_alb_target_processing_time_bucket," + elb + ",le=+Inf,path=/": {{value: 3, timestamp: 1}, {value: 1, timestamp: 2}},
+		"__name__=foo_alb_target_processing_time_sum," + labels:                     {{value: 0.65, timestamp: 1}, {value: 3, timestamp: 2}},
+		"__name__=foo_alb_target_processing_time_count," + labels:                   {{value: 3, timestamp: 1}, {value: 1, timestamp: 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Submit() sends %v, want %v", got, want)
+	}
+}
+
+func TestPrometheusRemoteWriteSink_Submit_bearerToken(t *testing.T) {
+	t.Setenv("TEST_PROMETHEUS_TOKEN", "token")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewPrometheusRemoteWriteSink(&Config{
+		PrometheusRemoteWrite: PrometheusRemoteWriteConfig{
+			Endpoint:          server.URL,
+			BearerTokenEnvKey: "TEST_PROMETHEUS_TOKEN",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sink.Submit([]Series{{Name: "request_count", Type: SeriesTypeCount, Points: []SeriesPoint{{Timestamp: 1, Value: 1}}}})
+	if err != nil {
+		t.Errorf("Submit() error = %v", err)
+	}
+}
+
+func TestNewPrometheusRemoteWriteSink_customTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []Tag
+		wantErr bool
+	}{
+		{name: "valid", tags: []Tag{{Name: "env"}, {Name: "service.name"}}},
+		{name: "le", tags: []Tag{{Name: "le"}}, wantErr: true},
+		{name: "reserved prefix", tags: []Tag{{Name: "__name__"}}, wantErr: true},
+		{name: "same as built-in tag", tags: []Tag{{Name: "path"}}, wantErr: true},
+		{name: "duplicated", tags: []Tag{{Name: "env"}, {Name: "env"}}, wantErr: true},
+		{name: "duplicated after conversion", tags: []Tag{{Name: "service.name"}, {Name: "service_name"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPrometheusRemoteWriteSink(&Config{
+				CustomTags:            tt.tags,
+				PrometheusRemoteWrite: PrometheusRemoteWriteConfig{Endpoint: "http://localhost:9009/api/v1/push"},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPrometheusRemoteWriteSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_promMetricName(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "foo.alb.request_count", want: "foo_alb_request_count"},
+		{s: "foo:bar-baz", want: "foo:bar_baz"},
+		{s: "1foo", want: "_foo"},
+	}
+	for _, tt := range tests {
+		if got := promMetricName(tt.s); got != tt.want {
+			t.Errorf("promMetricName(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
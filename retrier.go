@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 5
+	defaultRetryInitialBackoff = 1 * time.Second
+	defaultRetryMaxBackoff     = 30 * time.Second
+)
+
+// Retrier retries a request with jittered exponential backoff while the failure is retryable.
+type Retrier struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// sleep is replaceable for testing.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetrier returns the retrier of config, which must have been validated by RetryConfig.Validate.
+func NewRetrier(config RetryConfig) *Retrier {
+	config = config.withDefaults()
+	return &Retrier{
+		maxAttempts:    config.MaxAttempts,
+		initialBackoff: config.InitialBackoff,
+		maxBackoff:     config.MaxBackoff,
+		sleep:          sleepContext,
+	}
+}
+
+// withDefaults returns the config whose omitted settings are replaced with defaults.
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultRetryMaxBackoff
+	}
+	return c
+}
+
+// Validate rejects backoffs which are not positive, because jitter of them panics, and max_backoff shorter than initial_backoff.
+// Omitted settings are validated with their defaults.
+func (c RetryConfig) Validate() error {
+	c = c.withDefaults()
+	if c.InitialBackoff <= 0 {
+		return fmt.Errorf("submit_retry.initial_backoff must be positive: %s", c.InitialBackoff)
+	}
+	if c.MaxBackoff <= 0 {
+		return fmt.Errorf("submit_retry.max_backoff must be positive: %s", c.MaxBackoff)
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		return fmt.Errorf("submit_retry.max_backoff must not be shorter than initial_backoff %s: %s", c.InitialBackoff, c.MaxBackoff)
+	}
+	return nil
+}
+
+// Do calls f until it succeeds, fails permanently or reaches max attempts.
+// f returns the HTTP response to decide whether the failure is retryable. The response may be nil on network errors.
+func (r *Retrier) Do(ctx context.Context, name string, f func() (*http.Response, error)) error {
+	for attempt := 1; ; attempt++ {
+		resp, err := f()
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(resp, err) {
+			return fmt.Errorf("%s fails permanently: %w", name, err)
+		}
+		if attempt >= r.maxAttempts {
+			return fmt.Errorf("%s fails after %d attempts: %w", name, attempt, err)
+		}
+
+		wait := r.backoff(attempt)
+		if d, ok := rateLimitDelay(resp); ok {
+			// The delay is capped so that a broken header doesn't park the invocation until timeout.
+			wait = min(d, r.maxBackoff)
+		}
+		fmt.Fprintf(os.Stderr, "%s fails at attempt %d, retry after %s: %v\n", name, attempt, wait, err)
+		if err := r.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the duration to wait before the next attempt with "full jitter".
+// see: https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
+func (r *Retrier) backoff(attempt int) time.Duration {
+	d := r.initialBackoff
+	for i := 1; i < attempt && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+	return rand.N(min(d, r.maxBackoff)) + 1
+}
+
+// isRetryable returns true on network errors, rate limiting and server errors.
+// Other client errors (e.g. 400 Bad Request, 403 Forbidden) never succeed by retrying.
+func isRetryable(resp *http.Response, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if resp == nil {
+		return true
+	}
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// rateLimitDelay returns the duration specified by the server to wait until next request.
+// Datadog returns X-RateLimit-Reset as seconds until the rate limit is reset.
+// see: https://docs.datadoghq.com/api/latest/rate-limits/
+func rateLimitDelay(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(time.Until(t), 0), true
+		}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if v := resp.Header.Get("X-RateLimit-Reset"); v != "" {
+			if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestRetrier(slept *[]time.Duration) *Retrier {
+	r := NewRetrier(RetryConfig{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second})
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		*slept = append(*slept, d)
+		return nil
+	}
+	return r
+}
+
+func responseWithStatus(code int, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: code, Header: header}
+}
+
+func TestRetrier_Do(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []*http.Response
+		errs         []error
+		wantErr      bool
+		wantAttempts int
+		wantSlept    []time.Duration
+	}{
+		{
+			name:         "success at first attempt",
+			responses:    []*http.Response{responseWithStatus(202, nil)},
+			errs:         []error{nil},
+			wantErr:      false,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retry on server error and network error",
+			responses:    []*http.Response{responseWithStatus(503, nil), nil, responseWithStatus(202, nil)},
+			errs:         []error{errors.New("503"), errors.New("connection reset"), nil},
+			wantErr:      false,
+			wantAttempts: 3,
+		},
+		{
+			name:         "give up after max attempts",
+			responses:    []*http.Response{responseWithStatus(500, nil), responseWithStatus(502, nil), responseWithStatus(504, nil)},
+			errs:         []error{errors.New("500"), errors.New("502"), errors.New("504")},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name:         "don't retry on bad request",
+			responses:    []*http.Response{responseWithStatus(400, nil)},
+			errs:         []error{errors.New("400")},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "don't retry on forbidden",
+			responses:    []*http.Response{responseWithStatus(403, nil)},
+			errs:         []error{errors.New("403")},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "wait until rate limit is reset",
+			responses: []*http.Response{
+				responseWithStatus(429, http.Header{"X-Ratelimit-Reset": []string{"7"}}),
+				responseWithStatus(429, http.Header{"Retry-After": []string{"3"}}),
+				responseWithStatus(202, nil),
+			},
+			errs:         []error{errors.New("429"), errors.New("429"), nil},
+			wantErr:      false,
+			wantAttempts: 3,
+			wantSlept:    []time.Duration{7 * time.Second, 3 * time.Second},
+		},
+		{
+			name: "cap rate limit delay by max backoff",
+			responses: []*http.Response{
+				responseWithStatus(429, http.Header{"Retry-After": []string{"3600"}}),
+				responseWithStatus(202, nil),
+			},
+			errs:         []error{errors.New("429"), nil},
+			wantErr:      false,
+			wantAttempts: 2,
+			wantSlept:    []time.Duration{10 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var slept []time.Duration
+			r := newTestRetrier(&slept)
+
+			attempts := 0
+			err := r.Do(context.Background(), "test", func() (*http.Response, error) {
+				resp, err := tt.responses[attempts], tt.errs[attempts]
+				attempts++
+				return resp, err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Do() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if len(slept) != attempts-1 {
+				t.Errorf("Do() slept %d times, want %d", len(slept), attempts-1)
+			}
+			for i, d := range tt.wantSlept {
+				if slept[i] != d {
+					t.Errorf("Do() slept %v, want %v", slept, tt.wantSlept)
+				}
+			}
+		})
+	}
+}
+
+func TestRetrier_backoff(t *testing.T) {
+	r := NewRetrier(RetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	for attempt := 1; attempt <= 40; attempt++ {
+		for range 100 {
+			d := r.backoff(attempt)
+			upper := min(100*time.Millisecond<<(attempt-1), time.Second)
+			if attempt >= 32 {
+				upper = time.Second
+			}
+			if d <= 0 || d > upper {
+				t.Fatalf("backoff(%d) = %v, want in (0, %v]", attempt, d, upper)
+			}
+		}
+	}
+}
+
+func TestRetryConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  RetryConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: RetryConfig{}},
+		{name: "valid", config: RetryConfig{InitialBackoff: time.Second, MaxBackoff: time.Second}},
+		{name: "negative initial backoff", config: RetryConfig{InitialBackoff: -time.Second}, wantErr: true},
+		{name: "negative max backoff", config: RetryConfig{MaxBackoff: -time.Second}, wantErr: true},
+		{name: "max backoff shorter than initial backoff", config: RetryConfig{InitialBackoff: 2 * time.Second, MaxBackoff: time.Second}, wantErr: true},
+		{name: "initial backoff longer than default max backoff", config: RetryConfig{InitialBackoff: time.Minute}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"maps"
+	"slices"
+)
+
+type SeriesType int
+
+const (
+	// SeriesTypeCount is the number of events in each timestamp.
+	SeriesTypeCount SeriesType = iota
+	// SeriesTypeDistribution is all of values observed in each timestamp.
+	SeriesTypeDistribution
+)
+
+func (t SeriesType) String() string {
+	switch t {
+	case SeriesTypeCount:
+		return "count"
+	case SeriesTypeDistribution:
+		return "distribution"
+	}
+	return "unknown"
+}
+
+type SeriesTag struct {
+	Name  string
+	Value string
+}
+
+// String returns the tag in Datadog's `name:value` format.
+func (t SeriesTag) String() string {
+	return t.Name + ":" + t.Value
+}
+
+type SeriesPoint struct {
+	Timestamp Timestamp
+	// Value is used by count series.
+	Value float64
+	// Values is used by distribution series.
+	Values []float64
+}
+
+// Series is the sink-neutral representation of metrics.
+// Points are sorted by timestamp in ascending order. Tags may be shared between series, so sinks must not modify them.
+type Series struct {
+	Name   string
+	Type   SeriesType
+	Unit   string
+	Tags   []SeriesTag
+	Points []SeriesPoint
+}
+
+// TagStrings returns tags in Datadog's `name:value` format.
+func (s *Series) TagStrings() []string {
+	tags := make([]string, len(s.Tags))
+	for i, tag := range s.Tags {
+		tags[i] = tag.String()
+	}
+	return tags
+}
+
+// TagValue returns the value of the tag, or empty string when the series doesn't have the tag.
+func (s *Series) TagValue(name string) string {
+	for _, tag := range s.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// seriesTagNames is names of tags which SeriesBuilder adds to series of any log type besides custom tags.
+var seriesTagNames = []string{
+	"elb", "target_group_arn", "path", "method", "elb_status_code", "target_status_code", "target_status_code_group",
+	"backend_status_code", "backend_status_code_group", "ip_address", "error_reason",
+	"listener", "tls_protocol_version", "tls_cipher", "listener_port", "tls_protocol", "tls_verify_status", "log_type",
+}
+
+// SeriesBuilder builds series from metrics aggregated by LogFileReader.
+type SeriesBuilder struct {
+	requestCountMetricName           string
+	targetProcessingTimeMetricName   string
+	requestProcessingTimeMetricName  string
+	responseProcessingTimeMetricName string
+	totalLatencyMetricName           string
+	receivedBytesMetricName          string
+	sentBytesMetricName              string
+	requestSizeMetricName            string
+	responseSizeMetricName           string
+	noTargetResponseCountMetricName  string
+	malformedLinesMetricName         string
+	nlb                              NlbConfig
+	albConnection                    AlbConnectionConfig
+	customTags                       []Tag
+}
+
+func NewSeriesBuilder(config *Config) *SeriesBuilder {
+	return &SeriesBuilder{
+		requestCountMetricName:           config.RequestCountMetricName,
+		targetProcessingTimeMetricName:   config.TargetProcessingTimeMetricName,
+		requestProcessingTimeMetricName:  config.RequestProcessingTimeMetricName,
+		responseProcessingTimeMetricName: config.ResponseProcessingTimeMetricName,
+		totalLatencyMetricName:           config.TotalLatencyMetricName,
+		receivedBytesMetricName:          config.ReceivedBytesMetricName,
+		sentBytesMetricName:              config.SentBytesMetricName,
+		requestSizeMetricName:            config.RequestSizeMetricName,
+		responseSizeMetricName:           config.ResponseSizeMetricName,
+		noTargetResponseCountMetricName:  config.NoTargetResponseCountMetricName,
+		malformedLinesMetricName:         config.MalformedLines.MetricsName,
+		nlb:                              config.Nlb,
+		albConnection:                    config.AlbConnection,
+		customTags:                       config.CustomTags,
+	}
+}
+
+// Build returns series in the order of metric keys so that the result is deterministic.
+func (b *SeriesBuilder) Build(metrics map[string]*Metric) []Series {
+	var series []Series
+	for _, key := range slices.Sorted(maps.Keys(metrics)) {
+		metric := metrics[key]
+		if b.requestCountMetricName != "" {
+			series = append(series, b.requestCountSeries(metric))
+		}
+		// All of requests may have no response from target, whose target processing times are excluded.
+		if len(metric.TargetProcessingTimesMap) > 0 {
+			series = append(series, b.targetProcessingTimeSeries(metric))
+		}
+		series = append(series, b.noTargetResponseCountSeries(metric)...)
+		series = append(series, b.processingTimeSeries(b.requestProcessingTimeMetricName, metric, metric.RequestProcessingTimesMap)...)
+		series = append(series, b.processingTimeSeries(b.responseProcessingTimeMetricName, metric, metric.ResponseProcessingTimesMap)...)
+		series = append(series, b.processingTimeSeries(b.totalLatencyMetricName, metric, metric.TotalLatenciesMap)...)
+		series = append(series, b.bytesSeries(metric)...)
+	}
+	return series
+}
+
+// BuildMalformedLines returns series of the number of skipped malformed lines of each log type and load balancer
+// when its metric name is configured, in the order of metric keys.
+func (b *SeriesBuilder) BuildMalformedLines(metrics map[string]*MalformedLinesMetric) []Series {
+	if b.malformedLinesMetricName == "" {
+		return nil
+	}
+	var series []Series
+	for _, key := range slices.Sorted(maps.Keys(metrics)) {
+		metric := metrics[key]
+		tags := append([]SeriesTag{
+			{Name: "elb", Value: metric.Elb},
+			{Name: "log_type", Value: metric.LogType.String()},
+		}, b.customSeriesTags()...)
+		series = append(series, countSeries(b.malformedLinesMetricName, "line", tags, metric.CountMap))
+	}
+	return series
+}
+
+func (b *SeriesBuilder) requestCountSeries(metric *Metric) Series {
+	points := make([]SeriesPoint, 0, len(metric.RequestCountMap))
+	for _, timestamp := range sortedTimestamps(metric.RequestCountMap) {
+		points = append(points, SeriesPoint{
+			Timestamp: timestamp,
+			Value:     float64(metric.RequestCountMap[timestamp]),
+		})
+	}
+	return Series{
+		Name:   b.requestCountMetricName,
+		Type:   SeriesTypeCount,
+		Unit:   "request",
+		Tags:   append(requestTags(metric, false), b.customSeriesTags()...),
+		Points: points,
+	}
+}
+
+func (b *SeriesBuilder) targetProcessingTimeSeries(metric *Metric) Series {
+	points := make([]SeriesPoint, 0, len(metric.TargetProcessingTimesMap))
+	for _, timestamp := range sortedTimestamps(metric.TargetProcessingTimesMap) {
+		times := metric.TargetProcessingTimesMap[timestamp]
+		points = append(points, SeriesPoint{
+			Timestamp: timestamp,
+			Values:    *times.Float64(),
+		})
+	}
+	return Series{
+		Name:   b.targetProcessingTimeMetricName,
+		Type:   SeriesTypeDistribution,
+		Unit:   "second",
+		Tags:   append(requestTags(metric, true), b.customSeriesTags()...),
+		Points: points,
+	}
+}
+
+// processingTimeSeries returns the distribution series of times tagged in the same way as target processing time,
+// or nothing when the metric name isn't configured or all of requests were not dispatched to target.
+func (b *SeriesBuilder) processingTimeSeries(name string, metric *Metric, times map[Timestamp][]float64) []Series {
+	if name == "" || len(times) == 0 {
+		return nil
+	}
+	return []Series{distributionSeries(name, "second", append(requestTags(metric, true), b.customSeriesTags()...), times)}
+}
+
+// noTargetResponseCountSeries returns series of the number of requests without response from target by error reason,
+// or nothing when the metric name isn't configured.
+func (b *SeriesBuilder) noTargetResponseCountSeries(metric *Metric) []Series {
+	if b.noTargetResponseCountMetricName == "" {
+		return nil
+	}
+	var series []Series
+	for _, reason := range slices.Sorted(maps.Keys(metric.NoTargetResponseCountsMap)) {
+		tags := append(requestTags(metric, false), SeriesTag{Name: "error_reason", Value: reason})
+		tags = append(tags, b.customSeriesTags()...)
+		series = append(series, countSeries(b.noTargetResponseCountMetricName, "request", tags, metric.NoTargetResponseCountsMap[reason]))
+	}
+	return series
+}
+
+// bytesSeries returns series of bytes whose metric name is configured, tagged in the same way as request count.
+func (b *SeriesBuilder) bytesSeries(metric *Metric) []Series {
+	var series []Series
+	tags := append(requestTags(metric, false), b.customSeriesTags()...)
+	if b.receivedBytesMetricName != "" {
+		series = append(series, countSeries(b.receivedBytesMetricName, "byte", tags, metric.ReceivedBytesMap))
+	}
+	if b.sentBytesMetricName != "" {
+		series = append(series, countSeries(b.sentBytesMetricName, "byte", tags, metric.SentBytesMap))
+	}
+	if b.requestSizeMetricName != "" {
+		series = append(series, distributionSeries(b.requestSizeMetricName, "byte", tags, metric.RequestSizesMap))
+	}
+	if b.responseSizeMetricName != "" {
+		series = append(series, distributionSeries(b.responseSizeMetricName, "byte", tags, metric.ResponseSizesMap))
+	}
+	return series
+}
+
+// requestTags returns tags of series of requests, optionally with the group of target status code.
+// Metrics of CLB are tagged by backend instead of target, and have no target group.
+func requestTags(metric *Metric, withStatusCodeGroup bool) []SeriesTag {
+	if metric.LogType == LogTypeClb {
+		tags := []SeriesTag{
+			{Name: "elb", Value: metric.Elb},
+			{Name: "path", Value: metric.Path},
+			{Name: "method", Value: metric.Method},
+			{Name: "elb_status_code", Value: metric.ElbStatusCode},
+			{Name: "backend_status_code", Value: metric.TargetStatusCode},
+		}
+		if withStatusCodeGroup {
+			tags = append(tags, SeriesTag{Name: "backend_status_code_group", Value: metric.TargetStatusCodeGroup()})
+		}
+		return append(tags, SeriesTag{Name: "ip_address", Value: metric.IpAddress})
+	}
+
+	tags := []SeriesTag{
+		{Name: "elb", Value: metric.Elb},
+		{Name: "target_group_arn", Value: metric.TargetGroupArn},
+		{Name: "path", Value: metric.Path},
+		{Name: "method", Value: metric.Method},
+		{Name: "elb_status_code", Value: metric.ElbStatusCode},
+		{Name: "target_status_code", Value: metric.TargetStatusCode},
+	}
+	if withStatusCodeGroup {
+		tags = append(tags, SeriesTag{Name: "target_status_code_group", Value: metric.TargetStatusCodeGroup()})
+	}
+	return append(tags, SeriesTag{Name: "ip_address", Value: metric.IpAddress})
+}
+
+// BuildNlb returns series of NLB metrics whose name is configured, in the order of metric keys.
+func (b *SeriesBuilder) BuildNlb(metrics map[string]*NlbMetric) []Series {
+	var series []Series
+	for _, key := range slices.Sorted(maps.Keys(metrics)) {
+		metric := metrics[key]
+		tags := append([]SeriesTag{
+			{Name: "elb", Value: metric.Elb},
+			{Name: "listener", Value: metric.Listener},
+			{Name: "tls_protocol_version", Value: metric.TlsProtocolVersion},
+			{Name: "tls_cipher", Value: metric.TlsCipher},
+		}, b.customSeriesTags()...)
+		if b.nlb.ConnectionCountMetricName != "" {
+			series = append(series, countSeries(b.nlb.ConnectionCountMetricName, "connection", tags, metric.ConnectionCountMap))
+		}
+		if b.nlb.TlsHandshakeTimeMetricName != "" && len(metric.TlsHandshakeTimesMap) > 0 {
+			series = append(series, distributionSeries(b.nlb.TlsHandshakeTimeMetricName, "second", tags, metric.TlsHandshakeTimesMap))
+		}
+		if b.nlb.ReceivedBytesMetricName != "" {
+			series = append(series, countSeries(b.nlb.ReceivedBytesMetricName, "byte", tags, metric.ReceivedBytesMap))
+		}
+		if b.nlb.SentBytesMetricName != "" {
+			series = append(series, countSeries(b.nlb.SentBytesMetricName, "byte", tags, metric.SentBytesMap))
+		}
+	}
+	return series
+}
+
+// BuildAlbConnection returns series of ALB connection metrics whose name is configured, in the order of metric keys.
+func (b *SeriesBuilder) BuildAlbConnection(metrics map[string]*AlbConnectionMetric) []Series {
+	var series []Series
+	for _, key := range slices.Sorted(maps.Keys(metrics)) {
+		metric := metrics[key]
+		tags := append([]SeriesTag{
+			{Name: "elb", Value: metric.Elb},
+			{Name: "listener_port", Value: metric.ListenerPort},
+			{Name: "tls_protocol", Value: metric.TlsProtocol},
+			{Name: "tls_cipher", Value: metric.TlsCipher},
+			{Name: "tls_verify_status", Value: metric.TlsVerifyStatus},
+			{Name: "ip_address", Value: metric.IpAddress},
+		}, b.customSeriesTags()...)
+		if b.albConnection.ConnectionCountMetricName != "" {
+			series = append(series, countSeries(b.albConnection.ConnectionCountMetricName, "connection", tags, metric.ConnectionCountMap))
+		}
+		if b.albConnection.TlsHandshakeLatencyMetricName != "" && len(metric.TlsHandshakeLatenciesMap) > 0 {
+			series = append(series, distributionSeries(b.albConnection.TlsHandshakeLatencyMetricName, "second", tags, metric.TlsHandshakeLatenciesMap))
+		}
+	}
+	return series
+}
+
+// countSeries returns the count series of values in each timestamp.
+func countSeries(name string, unit string, tags []SeriesTag, values map[Timestamp]int) Series {
+	points := make([]SeriesPoint, 0, len(values))
+	for _, timestamp := range sortedTimestamps(values) {
+		points = append(points, SeriesPoint{Timestamp: timestamp, Value: float64(values[timestamp])})
+	}
+	return Series{Name: name, Type: SeriesTypeCount, Unit: unit, Tags: tags, Points: points}
+}
+
+// distributionSeries returns the distribution series of values in each timestamp.
+func distributionSeries(name string, unit string, tags []SeriesTag, values map[Timestamp][]float64) Series {
+	points := make([]SeriesPoint, 0, len(values))
+	for _, timestamp := range sortedTimestamps(values) {
+		points = append(points, SeriesPoint{Timestamp: timestamp, Values: values[timestamp]})
+	}
+	return Series{Name: name, Type: SeriesTypeDistribution, Unit: unit, Tags: tags, Points: points}
+}
+
+func (b *SeriesBuilder) customSeriesTags() []SeriesTag {
+	tags := make([]SeriesTag, 0, len(b.customTags))
+	for _, tag := range b.customTags {
+		tags = append(tags, SeriesTag{Name: tag.Name, Value: tag.Key()})
+	}
+	return tags
+}
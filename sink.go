@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Sink submits series to a metrics backend.
+type Sink interface {
+	Submit(series []Series) error
+}
+
+const (
+	SinkDatadog               = "datadog"
+	SinkPrometheusRemoteWrite = "prometheus_remote_write"
+	SinkOtlp                  = "otlp"
+	SinkDogStatsD             = "dogstatsd"
+	SinkCloudWatchEmf         = "cloudwatch_emf"
+	SinkStdout                = "stdout"
+)
+
+// NewSink returns the sink configured by `sinks`. Datadog is used when no sink is configured.
+// When multiple sinks are configured, returned sink submits series to all of them.
+// When DRY_RUN environment variable is true, configured sinks are ignored and series are printed to stdout.
+func NewSink(config *Config) (Sink, error) {
+	names := config.Sinks
+	if len(names) == 0 {
+		names = []string{SinkDatadog}
+	}
+	if isDryRun() {
+		names = []string{SinkStdout}
+	}
+
+	var sinks fanOutSink
+	for _, name := range names {
+		switch name {
+		case SinkDatadog:
+			sinks = append(sinks, NewMetricsSubmitter(config))
+		case SinkPrometheusRemoteWrite:
+			sink, err := NewPrometheusRemoteWriteSink(config)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case SinkOtlp:
+			sink, err := NewOtlpSink(config)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case SinkDogStatsD:
+			sink, err := NewDogStatsDSink(config)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case SinkCloudWatchEmf:
+			sink, err := NewCloudWatchEmfSink(config)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case SinkStdout:
+			sinks = append(sinks, NewStdoutSink())
+		default:
+			return nil, fmt.Errorf("unknown sink: %s", name)
+		}
+	}
+
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
+
+// fanOutSink submits series to all of sinks concurrently.
+// A failure of a sink doesn't stop submission to other sinks, and all of errors are returned.
+type fanOutSink []Sink
+
+func (s fanOutSink) Submit(series []Series) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(s))
+	for i, sink := range s {
+		wg.Go(func() {
+			errs[i] = sink.Submit(series)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// isDryRun returns whether DRY_RUN environment variable is true.
+func isDryRun() bool {
+	dryRun, _ := strconv.ParseBool(os.Getenv("DRY_RUN"))
+	return dryRun
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// recordingSink is the Sink recording submitted series for testing.
+type recordingSink struct {
+	mu     sync.Mutex
+	calls  int
+	series []Series
+	err    error
+}
+
+func (s *recordingSink) Submit(series []Series) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	s.series = append(s.series, series...)
+	return s.err
+}
+
+func TestFanOutSink_Submit(t *testing.T) {
+	ok := &recordingSink{}
+	failed := &recordingSink{err: errors.New("failed")}
+	sink := fanOutSink{failed, ok}
+
+	series := []Series{{Name: "request_count", Type: SeriesTypeCount}}
+	err := sink.Submit(series)
+	if !errors.Is(err, failed.err) {
+		t.Errorf("Submit() error = %v, want %v", err, failed.err)
+	}
+	for _, s := range []*recordingSink{ok, failed} {
+		if len(s.series) != 1 {
+			t.Errorf("Submit() submits %d series, want 1", len(s.series))
+		}
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		sinks   []string
+		dryRun  string
+		want    int
+		wantErr bool
+	}{
+		{name: "default", sinks: nil, want: 1},
+		{name: "datadog", sinks: []string{"datadog"}, want: 1},
+		{name: "multiple sinks", sinks: []string{"datadog", "datadog"}, want: 2},
+		{name: "unknown sink", sinks: []string{"unknown"}, wantErr: true},
+		{name: "dry run", sinks: []string{"datadog", "datadog"}, dryRun: "true", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DRY_RUN", tt.dryRun)
+			got, err := NewSink(&Config{Sinks: tt.sinks})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			n := 1
+			if s, ok := got.(fanOutSink); ok {
+				n = len(s)
+			}
+			if _, ok := got.(*StdoutSink); ok != (tt.dryRun != "") {
+				t.Errorf("NewSink() returns %T", got)
+			}
+			if n != tt.want {
+				t.Errorf("NewSink() returns %d sinks, want %d", n, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// StdoutSink is the Sink printing series to stdout as newline-delimited JSON without any network call.
+// It is useful to check tags of metrics when tuning configuration, and its output can be compared between configurations.
+type StdoutSink struct {
+	writer io.Writer
+}
+
+func NewStdoutSink() *StdoutSink {
+	return &StdoutSink{writer: os.Stdout}
+}
+
+type stdoutSeries struct {
+	Metric string        `json:"metric"`
+	Type   string        `json:"type"`
+	Unit   string        `json:"unit,omitempty"`
+	Tags   []string      `json:"tags"`
+	Points []stdoutPoint `json:"points"`
+}
+
+type stdoutPoint struct {
+	Timestamp int64     `json:"timestamp"`
+	Value     *float64  `json:"value,omitempty"`
+	Values    []float64 `json:"values,omitempty"`
+}
+
+func (s *StdoutSink) Submit(series []Series) error {
+	enc := json.NewEncoder(s.writer)
+	for _, se := range series {
+		out := stdoutSeries{
+			Metric: se.Name,
+			Type:   se.Type.String(),
+			Unit:   se.Unit,
+			Tags:   se.TagStrings(),
+			Points: make([]stdoutPoint, len(se.Points)),
+		}
+		for i, point := range se.Points {
+			out.Points[i].Timestamp = int64(point.Timestamp)
+			switch se.Type {
+			case SeriesTypeCount:
+				out.Points[i].Value = &point.Value
+			case SeriesTypeDistribution:
+				out.Points[i].Values = point.Values
+			}
+		}
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStdoutSink_Submit(t *testing.T) {
+	var buf bytes.Buffer
+	sink := &StdoutSink{writer: &buf}
+
+	tags := []SeriesTag{{Name: "elb", Value: "app/my-lb"}, {Name: "path", Value: "/"}}
+	err := sink.Submit([]Series{
+		{
+			Name:   "request_count",
+			Type:   SeriesTypeCount,
+			Unit:   "request",
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1656581400, Value: 3}, {Timestamp: 1656581401, Value: 1}},
+		},
+		{
+			Name:   "target_processing_time",
+			Type:   SeriesTypeDistribution,
+			Unit:   "second",
+			Tags:   tags,
+			Points: []SeriesPoint{{Timestamp: 1656581400, Values: []float64{0.5, 0.1}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	want := `{"metric":"request_count","type":"count","unit":"request","tags":["elb:app/my-lb","path:/"],"points":[{"timestamp":1656581400,"value":3},{"timestamp":1656581401,"value":1}]}
+{"metric":"target_processing_time","type":"distribution","unit":"second","tags":["elb:app/my-lb","path:/"],"points":[{"timestamp":1656581400,"values":[0.5,0.1]}]}
+`
+	if buf.String() != want {
+		t.Errorf("Submit() prints\n%s\nwant\n%s", buf.String(), want)
+	}
+}